@@ -11,6 +11,8 @@ import (
 )
 
 var cfgFile string
+var dryRun bool
+var offline bool
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -24,14 +26,42 @@ var rootCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 		api := pkg.NewAPI()
+		if config.CacheDir != "" || offline {
+			api.EnableCache(config.CacheDir, offline)
+		}
 		files := pkg.NewFiles(config)
+		files.Offline = offline
+		storage, err := pkg.NewMediaStorage(config.Markdown)
+		if err != nil {
+			log.Fatal(err)
+		}
+		files.SetStorage(storage)
+		images, err := pkg.NewImageOptimizer(config.Markdown)
+		if err != nil {
+			log.Fatal(err)
+		}
+		files.SetImageOptimizer(images)
 		tm := pkg.New()
+		if tm.Providers, err = pkg.NewProviderRegistry(config.Providers); err != nil {
+			log.Fatal(err)
+		}
 		caches := pkg.NewNotionCaches()
 		ns := pkg.NewNotionSite(api, tm, files, config, caches)
+		ns.SetTranslator(pkg.NewTranslator(config.Markdown.Translation))
+		if dryRun {
+			ns.EnableDryRun()
+		}
 
-		if err := pkg.Run(ns); err != nil {
+		err = pkg.Run(ns)
+		if err != nil {
 			log.Println(err)
 		}
+		if dryRun {
+			ns.Plan().Print(os.Stdout)
+			if err != nil || ns.Plan().Failed() {
+				os.Exit(1)
+			}
+		}
 	},
 }
 
@@ -48,6 +78,8 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is notion-site.yaml)")
+	rootCmd.Flags().BoolVar(&offline, "offline", false, "render from the Notion API cache only, without network or token")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "render into memory and print what would change, without touching disk or Notion")
 }
 
 // initConfig reads in config file and ENV variables if set.
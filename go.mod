@@ -16,6 +16,7 @@ require (
 	github.com/otiai10/opengraph v1.1.3
 	github.com/spf13/cobra v1.8.1
 	github.com/spf13/viper v1.19.0
+	golang.org/x/image v0.20.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// default folder of the Notion API response cache
+const defaultCacheDir = ".notion-cache"
+
+type cacheVersionKey struct{}
+
+// withCacheVersion tags the requests of ctx with a version, usually the page
+// last_edited_time. A cached response is reused while its version matches.
+func withCacheVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, cacheVersionKey{}, version)
+}
+
+type cacheEntry struct {
+	Key     string          `json:"key"`
+	Version string          `json:"version"`
+	Body    json.RawMessage `json:"body"`
+}
+
+// cacheTransport stores Notion API responses on disk, keyed by endpoint and
+// params. Offline it only answers from the cache and never hits the network.
+type cacheTransport struct {
+	dir     string
+	offline bool
+	next    http.RoundTripper
+}
+
+func newCacheTransport(dir string, offline bool) *cacheTransport {
+	return &cacheTransport{dir: dir, offline: offline, next: http.DefaultTransport}
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheable(req) {
+		if t.offline {
+			return nil, fmt.Errorf("offline: %s %s needs the network", req.Method, req.URL.Path)
+		}
+		return t.next.RoundTrip(req)
+	}
+	key, err := cacheKey(req)
+	if err != nil {
+		return nil, err
+	}
+	version, _ := req.Context().Value(cacheVersionKey{}).(string)
+	entry, ok := t.load(key)
+	if ok && (t.offline || (version != "" && entry.Version == version)) {
+		return cachedResponse(req, entry.Body), nil
+	}
+	if t.offline {
+		return nil, fmt.Errorf("offline: %s %s is not cached", req.Method, req.URL)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.store(cacheEntry{Key: key, Version: version, Body: body}); err != nil {
+		fmt.Println("⚠ Writing API cache:", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// cacheable reads and database queries, page updates always go to Notion
+func cacheable(req *http.Request) bool {
+	return req.Method == http.MethodGet ||
+		(req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/query"))
+}
+
+// cacheKey endpoint + params, plus the body of a database query
+func cacheKey(req *http.Request) (string, error) {
+	key := req.Method + " " + req.URL.Path + "?" + req.URL.Query().Encode()
+	if req.Body == nil {
+		return key, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return key + " " + string(body), nil
+}
+
+func (t *cacheTransport) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+func (t *cacheTransport) load(key string) (cacheEntry, bool) {
+	var entry cacheEntry
+	data, err := os.ReadFile(t.path(key))
+	if err != nil {
+		return entry, false
+	}
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Key != key {
+		return entry, false
+	}
+	return entry, true
+}
+
+func (t *cacheTransport) store(entry cacheEntry) error {
+	if err := os.MkdirAll(t.dir, defaultPermission); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.path(entry.Key), data, 0644)
+}
+
+func cachedResponse(req *http.Request, body []byte) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
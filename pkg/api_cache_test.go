@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type countingTransport struct {
+	calls int
+	body  string
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.calls++
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(c.body)), Request: req}, nil
+}
+
+func get(t *testing.T, rt http.RoundTripper, version string) (string, error) {
+	t.Helper()
+	ctx := withCacheVersion(context.Background(), version)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.notion.com/v1/blocks/abc/children?page_size=100", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return string(b), nil
+}
+
+func TestCacheTransport(t *testing.T) {
+	dir := t.TempDir()
+	next := &countingTransport{body: `{"results":[]}`}
+	rt := &cacheTransport{dir: dir, next: next}
+
+	for _, version := range []string{"v1", "v1", "v2"} {
+		if body, err := get(t, rt, version); err != nil || body != next.body {
+			t.Fatalf("version %s: got %q, %v", version, body, err)
+		}
+	}
+	if next.calls != 2 {
+		t.Errorf("same version should be served from cache, got %d calls", next.calls)
+	}
+
+	offline := &cacheTransport{dir: dir, offline: true, next: next}
+	if body, err := get(t, offline, "v3"); err != nil || body != next.body {
+		t.Errorf("offline should serve any cached version, got %q, %v", body, err)
+	}
+	if next.calls != 2 {
+		t.Errorf("offline must not hit the network, got %d calls", next.calls)
+	}
+
+	empty := &cacheTransport{dir: t.TempDir(), offline: true, next: next}
+	if _, err := get(t, empty, "v1"); err == nil {
+		t.Error("offline cache miss should fail")
+	}
+}
@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/otiai10/opengraph"
+)
+
+const (
+	bookmarkCacheName      = ".notion-bookmarks.json"
+	defaultBookmarkTTL     = 7 * 24 * time.Hour
+	defaultBookmarkTimeout = 10 * time.Second
+)
+
+// BookmarkMeta open graph metadata of a bookmarked page
+type BookmarkMeta struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	Icon        string    `json:"icon,omitempty"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+}
+
+// Bookmarks fetches bookmark metadata and keeps it on disk for TTL, so pages
+// aren't fetched again on every run, and stale metadata still serves when
+// they can't be fetched.
+type Bookmarks struct {
+	mu      sync.Mutex
+	path    string
+	ttl     time.Duration
+	client  *http.Client
+	Entries map[string]BookmarkMeta `json:"entries"`
+}
+
+func loadBookmarks(path string, ttl, timeout time.Duration) *Bookmarks {
+	if ttl <= 0 {
+		ttl = defaultBookmarkTTL
+	}
+	if timeout <= 0 {
+		timeout = defaultBookmarkTimeout
+	}
+	b := &Bookmarks{path: path, ttl: ttl, client: &http.Client{Timeout: timeout}, Entries: make(map[string]BookmarkMeta)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return b
+	}
+	if err := json.Unmarshal(data, b); err != nil {
+		fmt.Printf("⚠ Ignoring broken bookmark cache %s: %s\n", path, err)
+		b.Entries = make(map[string]BookmarkMeta)
+	}
+	return b
+}
+
+// Fetch metadata of rawURL, from the cache while it's fresh. Offline, or
+// when fetching fails, stale metadata is used if there is some.
+func (b *Bookmarks) Fetch(rawURL string, offline bool) (BookmarkMeta, error) {
+	b.mu.Lock()
+	cached, ok := b.Entries[rawURL]
+	b.mu.Unlock()
+	if ok && (offline || time.Since(cached.FetchedAt) < b.ttl) {
+		return cached, nil
+	}
+	if offline {
+		return BookmarkMeta{}, fmt.Errorf("offline: bookmark %s was never fetched", rawURL)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.client.Timeout)
+	defer cancel()
+	og, err := opengraph.FetchWithContext(ctx, rawURL, b.client)
+	if err != nil {
+		if ok {
+			fmt.Printf("⚠ Using cached bookmark %s: %s\n", rawURL, err)
+			return cached, nil
+		}
+		return BookmarkMeta{}, err
+	}
+	og.ToAbsURL()
+	meta := BookmarkMeta{URL: rawURL, Title: og.Title, Description: og.Description, Icon: og.Favicon, FetchedAt: time.Now()}
+	for _, img := range og.Image {
+		if img != nil && img.URL != "" {
+			meta.Image = img.URL
+			break
+		}
+	}
+	b.mu.Lock()
+	b.Entries[rawURL] = meta
+	b.mu.Unlock()
+	return meta, nil
+}
+
+func (b *Bookmarks) save() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.path, data, 0644)
+}
@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestBookmarksCache(t *testing.T) {
+	var hits int
+	up := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if !up {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`<html><head><meta property="og:title" content="Hello"><meta property="og:image" content="/cover.png"></head></html>`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), bookmarkCacheName)
+	b := loadBookmarks(path, time.Hour, time.Second)
+	for i := 0; i < 2; i++ {
+		meta, err := b.Fetch(srv.URL, false)
+		if err != nil || meta.Title != "Hello" || meta.Image != srv.URL+"/cover.png" {
+			t.Fatalf("got %+v, %v", meta, err)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("fresh metadata should come from the cache, got %d fetches", hits)
+	}
+	if err := b.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// expired and the site is down: the stale metadata still serves
+	b = loadBookmarks(path, time.Nanosecond, time.Second)
+	up = false
+	if meta, err := b.Fetch(srv.URL, false); err != nil || meta.Title != "Hello" || hits != 2 {
+		t.Errorf("got %+v, %v after %d fetches", meta, err, hits)
+	}
+	if _, err := b.Fetch(srv.URL+"/other", false); err == nil {
+		t.Error("a page never fetched should fail")
+	}
+	if _, err := b.Fetch(srv.URL+"/other", true); err == nil || hits != 3 {
+		t.Errorf("offline must not fetch, got %v after %d fetches", err, hits)
+	}
+}
+
+func TestBookmarkFallback(t *testing.T) {
+	tm := New()
+	tm.Files = NewFiles(Config{Markdown: Markdown{HomePath: t.TempDir()}})
+	tm.Files.Offline = true
+	bookmark := &notion.BookmarkBlock{
+		URL:     "https://example.com/post",
+		Caption: []notion.RichText{{Type: notion.RichTextTypeText, Text: &notion.Text{Content: "A **great** post"}}},
+	}
+	extra := map[string]any{}
+	if err := tm.injectBookmarkInfo(bookmark, &extra); err != nil {
+		t.Fatal(err)
+	}
+	if extra["Title"] != "A great post" || extra["Url"] != bookmark.URL {
+		t.Errorf("got %v", extra)
+	}
+}
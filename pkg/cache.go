@@ -1,20 +1,49 @@
 package pkg
 
+// default nesting limit of child databases, guards against cycles
+const defaultMaxDepth = 3
+
+// NotionCache is a child database found while rendering a page, processed
+// after its parent so the pages can be nested under the parent folder.
 type NotionCache struct {
-	ParentPropInfo  *NotionProp
-	ParentFilesInfo *Files
+	ParentPropInfo    *NotionProp
+	ParentFrontMatter map[string]any
+	// ParentPosition is the parent page folder relative to the home path
+	ParentPosition  string
 	ChildDatabaseId string
+	Depth           int
 }
 
 type NotionCaches struct {
-	TODO []*NotionCache
+	MaxDepth int
+	queue    []*NotionCache
+	seen     map[string]bool
 }
 
-func NewNotionCaches() []*NotionCache {
-	return []*NotionCache{}
-
+func NewNotionCaches() *NotionCaches {
+	return &NotionCaches{
+		MaxDepth: defaultMaxDepth,
+		seen:     make(map[string]bool),
+	}
 }
 
-func (caches *NotionCaches) SetCache(blockId string) {
+// SetCache queues a child database, it returns false when the database was
+// already queued or is nested deeper than MaxDepth.
+func (caches *NotionCaches) SetCache(cache *NotionCache) bool {
+	if caches.seen[cache.ChildDatabaseId] || cache.Depth > caches.MaxDepth {
+		return false
+	}
+	caches.seen[cache.ChildDatabaseId] = true
+	caches.queue = append(caches.queue, cache)
+	return true
+}
 
+// Next pops the next queued child database, nil when the queue is empty.
+func (caches *NotionCaches) Next() *NotionCache {
+	if len(caches.queue) == 0 {
+		return nil
+	}
+	cache := caches.queue[0]
+	caches.queue = caches.queue[1:]
+	return cache
 }
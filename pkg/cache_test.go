@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestNotionCaches(t *testing.T) {
+	caches := NewNotionCaches()
+	caches.MaxDepth = 2
+
+	if !caches.SetCache(&NotionCache{ChildDatabaseId: "a", Depth: 1}) {
+		t.Fatal("first child database should be queued")
+	}
+	if caches.SetCache(&NotionCache{ChildDatabaseId: "a", Depth: 2}) {
+		t.Error("a database already queued should be skipped")
+	}
+	if caches.SetCache(&NotionCache{ChildDatabaseId: "b", Depth: 3}) {
+		t.Error("a database deeper than MaxDepth should be skipped")
+	}
+	if c := caches.Next(); c == nil || c.ChildDatabaseId != "a" {
+		t.Fatalf("got %v, want database a", c)
+	}
+	if c := caches.Next(); c != nil {
+		t.Errorf("queue should be empty, got %v", c)
+	}
+}
+
+// pathRecorder answers every Notion request with a 404, recording its path
+type pathRecorder []string
+
+func (r *pathRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	*r = append(*r, req.URL.Path)
+	rec := httptest.NewRecorder()
+	rec.WriteHeader(http.StatusNotFound)
+	return rec.Result(), nil
+}
+
+func TestPageSourceChildDatabases(t *testing.T) {
+	paths := &pathRecorder{}
+	api := &NotionAPI{Client: notion.NewClient("secret", notion.WithHTTPClient(&http.Client{Transport: paths}))}
+	ns := &NotionSite{api: api, caches: NewNotionCaches(), config: Config{}}
+	// queued while rendering the tree pages
+	ns.caches.SetCache(&NotionCache{ChildDatabaseId: "db1", Depth: 1})
+
+	processSource(ns, Source{Name: "docs", Type: SourceTypePage, RootPageID: "root"})
+	if strings.Join(*paths, " ") != "/v1/pages/root /v1/databases/db1/query" {
+		t.Errorf("got requests %v", *paths)
+	}
+	if c := ns.caches.Next(); c != nil {
+		t.Errorf("child database %s left for the next source", c.ChildDatabaseId)
+	}
+}
@@ -0,0 +1,201 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+const commentsFileName = "comments.json"
+
+// Comment a Notion comment, as written to comments.json
+type Comment struct {
+	ID           string `json:"id"`
+	DiscussionID string `json:"discussionId"`
+	// BlockID the commented block, empty for comments on the page itself
+	BlockID     string    `json:"blockId,omitempty"`
+	Author      string    `json:"author"`
+	AuthorID    string    `json:"authorId"`
+	Avatar      string    `json:"avatar,omitempty"`
+	CreatedTime time.Time `json:"createdTime"`
+	// Text the rich text as markdown
+	Text     string            `json:"text"`
+	RichText []notion.RichText `json:"richText"`
+}
+
+// Discussion a comment thread, on a block or on the page
+type Discussion struct {
+	ID       string
+	BlockID  string
+	Comments []Comment
+}
+
+// loadComments comments of the page and of the blockIDs
+func (ns *NotionSite) loadComments(page notion.Page, blockIDs []string) ([]Comment, error) {
+	ids := append([]string{page.ID}, blockIDs...)
+	raw, err := ns.api.FindBlockChildrenCommentLoop(ns.api.Client, ids)
+	if err != nil {
+		return nil, err
+	}
+	comments := make([]Comment, 0, len(raw))
+	for _, c := range raw {
+		user := ns.api.findUser(ns.api.Client, c.CreatedBy.ID)
+		comments = append(comments, Comment{
+			ID:           c.ID,
+			DiscussionID: c.DiscussionID,
+			BlockID:      c.Parent.BlockID,
+			Author:       user.Name,
+			AuthorID:     c.CreatedBy.ID,
+			Avatar:       user.AvatarURL,
+			CreatedTime:  c.CreatedTime,
+			Text:         ConvertRichText(c.RichText),
+			RichText:     c.RichText,
+		})
+	}
+	return comments, nil
+}
+
+// exportComments writes comments.json next to the page and hands the threads
+// to the renderer. Failures only lose the comments, e.g. without the read
+// comments capability.
+func (ns *NotionSite) exportComments(page notion.Page, blockIDs []string) {
+	if ns.config.Comments == "" {
+		return
+	}
+	comments, err := ns.loadComments(page, blockIDs)
+	if err != nil {
+		fmt.Printf("⚠ Comments of %s: %s\n", page.URL, err)
+		return
+	}
+	if len(comments) == 0 {
+		return
+	}
+	data, err := json.MarshalIndent(comments, "", "  ")
+	if err != nil {
+		fmt.Printf("⚠ Comments of %s: %s\n", page.URL, err)
+		return
+	}
+	if err := ns.writeFile(filepath.Join(ns.files.FileFolderPath, languageFileName(commentsFileName, ns.currentPageProp.Language)), data); err != nil {
+		fmt.Printf("⚠ Comments of %s: %s\n", page.URL, err)
+		return
+	}
+	fmt.Printf("💬 Comments: %d\n", len(comments))
+	ns.tm.Discussions = groupDiscussions(comments)
+}
+
+// groupDiscussions threads in order of their first comment
+func groupDiscussions(comments []Comment) []Discussion {
+	var discussions []Discussion
+	index := make(map[string]int)
+	for _, c := range comments {
+		i, ok := index[c.DiscussionID]
+		if !ok {
+			i = len(discussions)
+			index[c.DiscussionID] = i
+			discussions = append(discussions, Discussion{ID: c.DiscussionID, BlockID: c.BlockID})
+		}
+		discussions[i].Comments = append(discussions[i].Comments, c)
+	}
+	return discussions
+}
+
+// commentRefs footnote references of the threads on blockID, "" for the page
+func (tm *ToMarkdown) commentRefs(blockID string) string {
+	var refs string
+	for i, d := range tm.Discussions {
+		if d.BlockID == blockID {
+			refs += fmt.Sprintf("[^comment-%d]", i+1)
+		}
+	}
+	return refs
+}
+
+// genCommentRefs records the rendered blockID and, for footnotes, leaves a
+// token for its references at the end of the block output
+func (tm *ToMarkdown) genCommentRefs(blockID string) {
+	if tm.CommentsMode == "" {
+		return
+	}
+	tm.commentBlocks = append(tm.commentBlocks, blockID)
+	if tm.CommentsMode != CommentsFootnotes {
+		return
+	}
+	refs := fmt.Sprintf("@@comment:%d@@", len(tm.commentBlocks)-1)
+	content := tm.ContentBuffer.String()
+	trimmed := strings.TrimRight(content, "\n")
+	end := len(trimmed)
+	// the heading anchor must stay last for hugo to read it
+	if m := headingAnchor.FindStringSubmatchIndex(trimmed); m != nil {
+		end = m[2]
+	}
+	tm.ContentBuffer.Truncate(end)
+	// a closing code fence can't be followed by anything
+	if strings.HasSuffix(trimmed, "```") {
+		tm.ContentBuffer.WriteString("\n\n" + refs)
+	} else {
+		tm.ContentBuffer.WriteString(" " + refs)
+	}
+	tm.ContentBuffer.WriteString(content[end:])
+}
+
+var headingAnchor = regexp.MustCompile(`(?m)^#+ .*?( \{#[^}]*\})\z`)
+
+var commentToken = regexp.MustCompile(`( |\n\n)@@comment:(\d+)@@`)
+
+// resolveCommentRefs replaces the tokens of genCommentRefs by the references
+// of the loaded threads, blocks without any lose their token
+func (tm *ToMarkdown) resolveCommentRefs() {
+	content := commentToken.ReplaceAllStringFunc(tm.ContentBuffer.String(), func(token string) string {
+		m := commentToken.FindStringSubmatch(token)
+		i, _ := strconv.Atoi(m[2])
+		if refs := tm.commentRefs(tm.commentBlocks[i]); refs != "" {
+			return m[1] + refs
+		}
+		return ""
+	})
+	tm.ContentBuffer.Reset()
+	tm.ContentBuffer.WriteString(content)
+}
+
+// genDiscussions the footnotes, or the discussion template, after the content
+func (tm *ToMarkdown) genDiscussions() error {
+	if len(tm.Discussions) == 0 {
+		return nil
+	}
+	switch tm.CommentsMode {
+	case CommentsFootnotes:
+		// page threads get a paragraph of their own
+		if refs := tm.commentRefs(""); refs != "" {
+			tm.ContentBuffer.WriteString("\n" + refs + "\n")
+		}
+		tm.ContentBuffer.WriteString("\n")
+		for i, d := range tm.Discussions {
+			for j, c := range d.Comments {
+				text := fmt.Sprintf("**%s** · %s: %s", c.AuthorName(), c.CreatedTime.Format(time.DateOnly), c.Text)
+				text = strings.ReplaceAll(text, "\n", "\n    ")
+				if j == 0 {
+					fmt.Fprintf(tm.ContentBuffer, "[^comment-%d]: %s\n", i+1, text)
+				} else {
+					fmt.Fprintf(tm.ContentBuffer, "\n    %s\n", text)
+				}
+			}
+		}
+	case CommentsDiscussion:
+		return tm.GenBlock("discussion", MdBlock{Extra: map[string]any{"Discussions": tm.Discussions}}, false, true)
+	}
+	return nil
+}
+
+// AuthorName the author, Anonymous without the user information capability
+func (c Comment) AuthorName() string {
+	if c.Author == "" {
+		return "Anonymous"
+	}
+	return c.Author
+}
@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// notionStub answers the comments and users endpoints of the Notion API
+type notionStub struct {
+	// comments by block id, each slice is one page of results
+	comments map[string][][]notion.Comment
+	queries  []string
+}
+
+func (s *notionStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	switch {
+	case req.URL.Path == "/v1/comments":
+		s.queries = append(s.queries, req.URL.RawQuery)
+		pages := s.comments[req.URL.Query().Get("block_id")]
+		page := 0
+		if cursor := req.URL.Query().Get("start_cursor"); cursor != "" {
+			page = int(cursor[0] - '0')
+		}
+		res := notion.FindCommentsResponse{Results: []notion.Comment{}}
+		if page < len(pages) {
+			res.Results = pages[page]
+		}
+		if page+1 < len(pages) {
+			next := string(rune('0' + page + 1))
+			res.HasMore, res.NextCursor = true, &next
+		}
+		json.NewEncoder(rec).Encode(res)
+	case strings.HasPrefix(req.URL.Path, "/v1/users/"):
+		json.NewEncoder(rec).Encode(notion.User{BaseUser: notion.BaseUser{ID: "u1"}, Name: "Ann"})
+	default:
+		rec.WriteHeader(http.StatusNotFound)
+	}
+	return rec.Result(), nil
+}
+
+func comment(id, discussion, blockID, text string) notion.Comment {
+	return notion.Comment{
+		ID: id, DiscussionID: discussion,
+		Parent:      notion.Parent{Type: notion.ParentTypeBlock, BlockID: blockID},
+		RichText:    []notion.RichText{{Type: notion.RichTextTypeText, Text: &notion.Text{Content: text}, PlainText: text}},
+		CreatedTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		CreatedBy:   notion.BaseUser{ID: "u1"},
+	}
+}
+
+func TestFindBlockChildrenCommentLoop(t *testing.T) {
+	stub := &notionStub{comments: map[string][][]notion.Comment{
+		"a": {{comment("1", "d1", "a", "one")}, {comment("2", "d1", "a", "two")}},
+		"b": {{comment("3", "d2", "b", "three")}},
+	}}
+	api := &NotionAPI{Client: notion.NewClient("secret", notion.WithHTTPClient(&http.Client{Transport: stub}))}
+	comments, err := api.FindBlockChildrenCommentLoop(api.Client, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 3 {
+		t.Errorf("got %d comments, want 3", len(comments))
+	}
+	// every block starts from its first page
+	want := []string{"block_id=a&page_size=100", "block_id=a&page_size=100&start_cursor=1", "block_id=b&page_size=100", "block_id=c&page_size=100"}
+	if strings.Join(stub.queries, " ") != strings.Join(want, " ") {
+		t.Errorf("got queries %v", stub.queries)
+	}
+	if user := api.findUser(api.Client, "u1"); user.Name != "Ann" {
+		t.Errorf("got user %+v", user)
+	}
+}
+
+func TestCommentFootnotes(t *testing.T) {
+	tm := New()
+	tm.NotionProps = &NotionProp{}
+	tm.CommentsMode = CommentsFootnotes
+	tm.ContentBuffer = new(bytes.Buffer)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tm.Discussions = groupDiscussions([]Comment{
+		{DiscussionID: "d1", BlockID: "p1", Author: "Ann", CreatedTime: created, Text: "Nice"},
+		{DiscussionID: "d2", Text: "About the page", CreatedTime: created},
+		{DiscussionID: "d1", BlockID: "p1", Author: "Bob", CreatedTime: created, Text: "Thanks"},
+	})
+	tm.ContentBuffer.WriteString("Hello world\n\n")
+	tm.genCommentRefs("p1")
+	tm.resolveCommentRefs()
+	if err := tm.genDiscussions(); err != nil {
+		t.Fatal(err)
+	}
+	want := "Hello world [^comment-1]\n\n\n[^comment-2]\n\n" +
+		"[^comment-1]: **Ann** · 2024-01-02: Nice\n\n    **Bob** · 2024-01-02: Thanks\n" +
+		"[^comment-2]: **Anonymous** · 2024-01-02: About the page\n"
+	if got := tm.ContentBuffer.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	tm.CommentsMode = CommentsDiscussion
+	tm.Flavor = FlavorCommonMark
+	tm.ContentBuffer.Reset()
+	if err := tm.genDiscussions(); err != nil {
+		t.Fatal(err)
+	}
+	want = "\n## Comments\n\n- **Ann** · 2024-01-02: Nice\n  - **Bob** · 2024-01-02: Thanks\n- **Anonymous** · 2024-01-02: About the page\n"
+	if got := tm.ContentBuffer.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// blocksFromJSON blocks with ids, as the API returns them
+func blocksFromJSON(t *testing.T, results string) []notion.Block {
+	t.Helper()
+	var res notion.BlockChildrenResponse
+	if err := json.Unmarshal([]byte(`{"results": `+results+`}`), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res.Results
+}
+
+func TestCommentsOfRenderedBlocks(t *testing.T) {
+	stub := &notionStub{comments: map[string][][]notion.Comment{
+		"p2": {{comment("1", "d1", "p2", "Nice")}},
+	}}
+	out := new(bytes.Buffer)
+	ns := &NotionSite{
+		config:          Config{Markdown: Markdown{Comments: CommentsFootnotes}},
+		api:             &NotionAPI{Client: notion.NewClient("secret", notion.WithHTTPClient(&http.Client{Transport: stub}))},
+		tm:              New(),
+		plan:            NewPlan(),
+		files:           &Files{queue: newMediaQueue(), currentWriter: out},
+		currentPage:     notion.Page{ID: "page"},
+		currentPageProp: &NotionProp{},
+		currentBlocks: blocksFromJSON(t, `[
+			{"object": "block", "id": "p1", "type": "paragraph", "paragraph": {"rich_text": [{"type": "text", "text": {"content": "Hello"}, "plain_text": "Hello"}]}},
+			{"object": "block", "id": "p2", "type": "paragraph", "paragraph": {"rich_text": [{"type": "text", "text": {"content": "World"}, "plain_text": "World"}]}}
+		]`),
+	}
+	ns.tm.NotionProps = &NotionProp{}
+	ns.tm.CommentsMode = CommentsFootnotes
+	if _, err := ns.tm.GenerateTo(ns); err != nil {
+		t.Fatal(err)
+	}
+	// the ids come from the rendering, one request for each rendered block
+	want := []string{"block_id=page&page_size=100", "block_id=p1&page_size=100", "block_id=p2&page_size=100"}
+	if strings.Join(stub.queries, " ") != strings.Join(want, " ") {
+		t.Errorf("got queries %v", stub.queries)
+	}
+	if got := out.String(); !strings.Contains(got, "Hello\n") || !strings.Contains(got, "World [^comment-1]\n") || strings.Contains(got, "@@") {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCommentRefsOfHeadings(t *testing.T) {
+	tm := New()
+	tm.NotionProps = &NotionProp{}
+	tm.CommentsMode = CommentsFootnotes
+	tm.Discussions = []Discussion{{ID: "d1", BlockID: "h1"}}
+	tm.ContentBuffer = bytes.NewBufferString("## Intro {#intro}\n")
+	tm.genCommentRefs("h1")
+	tm.resolveCommentRefs()
+	if got := tm.ContentBuffer.String(); got != "## Intro [^comment-1] {#intro}\n" {
+		t.Errorf("got %q", got)
+	}
+}
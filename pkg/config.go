@@ -13,15 +13,101 @@ type Notion struct {
 	FilterProp     string   `yaml:"filterProp"`
 	FilterValue    []string `yaml:"filterValue"`
 	PublishedValue string   `yaml:"publishedValue"`
+	// MaxDepth limits how deep child databases are followed, default 3
+	MaxDepth int `yaml:"maxDepth,omitempty"`
+	// CacheDir keeps Notion API responses on disk, see --offline
+	CacheDir string `yaml:"cacheDir,omitempty"`
+	// LanguageProp select or text property of the page language code, pages
+	// without one are in DefaultLanguage. Translations share a slug or are
+	// linked through TranslationProp, a relation property.
+	LanguageProp    string `yaml:"languageProp,omitempty"`
+	DefaultLanguage string `yaml:"defaultLanguage,omitempty"`
+	TranslationProp string `yaml:"translationProp,omitempty"`
 }
 
 type Markdown struct {
-	HomePath        string `yaml:"homePath"`
+	HomePath string `yaml:"homePath"`
+	// ImagePublicLink when set, media are linked as ImagePublicLink + their path
 	ImagePublicLink string `yaml:"imagePublicLink"`
 
 	// Optional:
 	GroupByMonth bool   `yaml:"groupByMonth,omitempty"`
 	Template     string `yaml:"template,omitempty"`
+	// MediaStore "shared" saves media of all pages into SharedMediaPath (default static/media)
+	MediaStore      string `yaml:"mediaStore,omitempty"`
+	SharedMediaPath string `yaml:"sharedMediaPath,omitempty"`
+	// MediaUploadPath saves media there instead of the content, to upload them to ImagePublicLink
+	MediaUploadPath string `yaml:"mediaUploadPath,omitempty"`
+	// DownloadTimeout in seconds (default 30), MaxMediaSize in MB (default 50)
+	DownloadTimeout int `yaml:"downloadTimeout,omitempty"`
+	MaxMediaSize    int `yaml:"maxMediaSize,omitempty"`
+	// MediaConcurrency parallel media downloads, default 4
+	MediaConcurrency int `yaml:"mediaConcurrency,omitempty"`
+	// ImageMaxWidth resizes wider images, ImageFormat (jpeg or png, webp can't
+	// be written) re-encodes them with ImageQuality (default 85), both strip
+	// the image metadata
+	ImageMaxWidth int    `yaml:"imageMaxWidth,omitempty"`
+	ImageFormat   string `yaml:"imageFormat,omitempty"`
+	ImageQuality  int    `yaml:"imageQuality,omitempty"`
+	// ImageFigure renders images as figures with their caption, see image.ntpl
+	ImageFigure       bool `yaml:"imageFigure,omitempty"`
+	ImageLinkOriginal bool `yaml:"imageLinkOriginal,omitempty"`
+	// FrontMatterFiles "first" writes only the first file of files & media
+	// properties, default all of them as a list
+	FrontMatterFiles string `yaml:"frontMatterFiles,omitempty"`
+	// CoverKey (default image) and IconKey (default icon) front matter keys
+	// of the page cover and icon
+	CoverKey string `yaml:"coverKey,omitempty"`
+	IconKey  string `yaml:"iconKey,omitempty"`
+	// OGCard generates a social card as cover of pages without one, drawn
+	// with OGCardFont (a ttf/otf file, default the Go font)
+	OGCard     bool   `yaml:"ogCard,omitempty"`
+	OGCardFont string `yaml:"ogCardFont,omitempty"`
+	// BookmarkTTL hours bookmark metadata is cached (default 168),
+	// BookmarkTimeout seconds to fetch it (default 10), BookmarkImages
+	// downloads their preview images and icons
+	BookmarkTTL     int  `yaml:"bookmarkTTL,omitempty"`
+	BookmarkTimeout int  `yaml:"bookmarkTimeout,omitempty"`
+	BookmarkImages  bool `yaml:"bookmarkImages,omitempty"`
+	// MediaStorage local (default) or s3, to upload media to S3 compatible storage
+	MediaStorage string `yaml:"mediaStorage,omitempty"`
+	S3           S3     `yaml:"s3,omitempty"`
+	// Comments exports the Notion comments of pages to comments.json: json
+	// only, footnotes or discussion also render them into the page
+	Comments string `yaml:"comments,omitempty"`
+	// SummaryBreak places the <!--more--> tag: off, bytes (default), words or
+	// paragraphs after SummaryLength of them, or at the first top level
+	// divider or <!--more--> paragraph (divider, marker)
+	SummaryBreak  string `yaml:"summaryBreak,omitempty"`
+	SummaryLength int    `yaml:"summaryLength,omitempty"`
+	// LanguageFrontMatter front matter defaults of the pages of each language
+	LanguageFrontMatter map[string]map[string]any `yaml:"languageFrontMatter,omitempty"`
+	// Translation machine translates pages missing one of its languages
+	Translation Translation `yaml:"translation,omitempty"`
+}
+
+// Translation of the pages missing one of Languages, from their default
+// language version, through the HTTPTranslator at Endpoint
+type Translation struct {
+	Languages []string `yaml:"languages,omitempty"`
+	Endpoint  string   `yaml:"endpoint,omitempty"`
+	// APIKey bearer token, default TRANSLATION_API_KEY
+	APIKey string `yaml:"apiKey,omitempty"`
+	// Timeout in seconds, default 120
+	Timeout int `yaml:"timeout,omitempty"`
+	// Keys front matter values translated too, default title, description and summary
+	Keys []string `yaml:"keys,omitempty"`
+}
+
+// S3 bucket media are uploaded to, credentials default to
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+type S3 struct {
+	Endpoint  string `yaml:"endpoint,omitempty"`
+	Region    string `yaml:"region,omitempty"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix,omitempty"`
+	AccessKey string `yaml:"accessKey,omitempty"`
+	SecretKey string `yaml:"secretKey,omitempty"`
 }
 
 // 动态属性配置结构
@@ -32,10 +118,88 @@ type PropDef struct {
 	DefaultValue interface{} `yaml:"defaultValue"`
 }
 
+const (
+	FlavorHugo       = "hugo"
+	FlavorCommonMark = "commonmark"
+)
+
+const FrontMatterFilesFirst = "first"
+
+const (
+	SummaryOff        = "off"
+	SummaryBytes      = "bytes"
+	SummaryWords      = "words"
+	SummaryParagraphs = "paragraphs"
+	SummaryDivider    = "divider"
+	SummaryMarker     = "marker"
+)
+
+const (
+	CommentsJSON       = "json"
+	CommentsFootnotes  = "footnotes"
+	CommentsDiscussion = "discussion"
+)
+
+const (
+	defaultCoverKey = "image"
+	defaultIconKey  = "icon"
+)
+
+const (
+	SourceTypeDatabase = "database"
+	SourceTypePage     = "page"
+)
+
+// Source is one Notion database, or page tree, rendered into its own section
+// of the site. Empty filter fields fall back to the top level notion config.
+type Source struct {
+	Name           string         `yaml:"name"`
+	Type           string         `yaml:"type,omitempty"`
+	DatabaseID     string         `yaml:"databaseId,omitempty"`
+	RootPageID     string         `yaml:"rootPageId,omitempty"`
+	FilterProp     string         `yaml:"filterProp,omitempty"`
+	FilterValue    []string       `yaml:"filterValue,omitempty"`
+	PublishedValue string         `yaml:"publishedValue,omitempty"`
+	Position       string         `yaml:"position,omitempty"`
+	Flavor         string         `yaml:"flavor,omitempty"`
+	FrontMatter    map[string]any `yaml:"frontMatter,omitempty"`
+}
+
 type Config struct {
 	Notion       `yaml:"notion"`
 	Markdown     `yaml:"markdown"`
+	Sources      []Source  `yaml:"sources,omitempty"`
 	DynamicProps []PropDef `yaml:"dynamicProps,omitempty"`
+	// Providers add or replace (by name) the built-in embed providers
+	Providers []Provider `yaml:"providers,omitempty"`
+}
+
+// GetSources returns the configured sources, or a single source built from
+// the notion section for configs without a sources list.
+func (c Config) GetSources() []Source {
+	if len(c.Sources) == 0 {
+		return []Source{{
+			Name:       "default",
+			DatabaseID: c.DatabaseID,
+		}}
+	}
+	return c.Sources
+}
+
+// NotionConfig merges the source filter with the top level notion config.
+func (s Source) NotionConfig(base Notion) Notion {
+	n := base
+	n.DatabaseID = s.DatabaseID
+	if s.FilterProp != "" {
+		n.FilterProp = s.FilterProp
+	}
+	if len(s.FilterValue) > 0 {
+		n.FilterValue = s.FilterValue
+	}
+	if s.PublishedValue != "" {
+		n.PublishedValue = s.PublishedValue
+	}
+	return n
 }
 
 func DefaultConfigInit() error {
@@ -0,0 +1,124 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDownloadTimeout = 30 * time.Second
+	defaultMaxMediaSize    = 50 << 20
+)
+
+// preferred extensions, mime.ExtensionsByType returns them in no useful order
+var contentTypeExt = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/svg+xml":   ".svg",
+	"image/avif":      ".avif",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"video/quicktime": ".mov",
+	"audio/mpeg":      ".mp3",
+	"audio/wav":       ".wav",
+	"audio/ogg":       ".ogg",
+	"application/pdf": ".pdf",
+}
+
+// Downloader fetches media with a timeout and size limit, and writes them
+// atomically so a failed download never leaves a broken file behind.
+type Downloader struct {
+	client  *http.Client
+	maxSize int64
+}
+
+func NewDownloader(timeout time.Duration, maxSize int64) *Downloader {
+	if timeout <= 0 {
+		timeout = defaultDownloadTimeout
+	}
+	if maxSize <= 0 {
+		maxSize = defaultMaxMediaSize
+	}
+	return &Downloader{client: &http.Client{Timeout: timeout}, maxSize: maxSize}
+}
+
+// Download saves rawURL into dir, named after its content hash, and returns the file name.
+func (d *Downloader) Download(rawURL, dir string) (string, error) {
+	prefix, ext, err := mediaPrefix(rawURL)
+	if err != nil {
+		return "", err
+	}
+	resp, err := d.client.Get(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("download %s: %w", redactURL(rawURL), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download %s: %s", redactURL(rawURL), resp.Status)
+	}
+	if resp.ContentLength > d.maxSize {
+		return "", fmt.Errorf("download %s: %d bytes exceeds the %d bytes limit", redactURL(rawURL), resp.ContentLength, d.maxSize)
+	}
+	if ext == "" {
+		ext = extByContentType(resp.Header.Get("Content-Type"))
+	}
+
+	if err := os.MkdirAll(dir, defaultPermission); err != nil {
+		return "", fmt.Errorf("%s: %s", dir, err)
+	}
+	out, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		return "", fmt.Errorf("couldn't create media file: %s", err)
+	}
+	defer os.Remove(out.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, hash), io.LimitReader(resp.Body, d.maxSize+1))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("download %s: %w", redactURL(rawURL), err)
+	}
+	if n > d.maxSize {
+		return "", fmt.Errorf("download %s: exceeds the %d bytes limit", redactURL(rawURL), d.maxSize)
+	}
+
+	filename := contentName(prefix, hash.Sum(nil), ext)
+	return filename, os.Rename(out.Name(), filepath.Join(dir, filename))
+}
+
+func extByContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if ext, ok := contentTypeExt[mediaType]; ok {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// redactURL drops the query, Notion file urls carry their signature there
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.RawQuery = ""
+	return strings.TrimSuffix(u.String(), "?")
+}
@@ -0,0 +1,49 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/expired.png":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("<Error>AccessDenied</Error>"))
+		case "/big.png":
+			w.Write([]byte(strings.Repeat("x", 64)))
+		default:
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte("jpeg"))
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d := NewDownloader(time.Second, 32)
+
+	name, err := d.Download(srv.URL+"/files/photo", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(name) != ".jpg" {
+		t.Errorf("extension should come from Content-Type, got %s", name)
+	}
+	if _, err := d.Download(srv.URL+"/expired.png?X-Amz-Signature=secret", dir); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("403 should fail without leaking the signature, got %v", err)
+	}
+	if _, err := d.Download(srv.URL+"/big.png", dir); err == nil {
+		t.Error("media over the size limit should fail")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("only the successful download should be on disk, got %d files", len(entries))
+	}
+}
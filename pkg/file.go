@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"github.com/dstotijn/go-notion"
 	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -17,6 +15,7 @@ import (
 const defaultPermission = 0755
 const mediaRelativePath = "media"
 const defaultMarkdownName = "index.md"
+const sectionMarkdownName = "_index.md"
 
 type Files struct {
 	Permission               uint32
@@ -31,6 +30,26 @@ type Files struct {
 	DefaultGalleryFolderName string
 	currentWriter            io.Writer
 	CurrentNTPL              string
+	// MediaStore "shared" keeps media of all pages in SharedMediaPath instead of the page bundle
+	MediaStore      string
+	SharedMediaPath string
+	// ImagePublicLink prefixes media links, e.g. a CDN. MediaUploadPath keeps
+	// the media out of the content, in a folder synced to that link.
+	ImagePublicLink string
+	MediaUploadPath string
+	// Offline reuses media downloaded by earlier runs instead of fetching it
+	Offline bool
+	// MediaConcurrency bounds the parallel media downloads, default 4
+	MediaConcurrency int
+	// BookmarkImages downloads the preview images of bookmarks instead of hotlinking them
+	BookmarkImages bool
+	bookmarks      *Bookmarks
+	plan           *Plan
+	media          *mediaIndex
+	downloader     *Downloader
+	queue          *mediaQueue
+	images         *ImageOptimizer
+	storage        MediaStorage
 }
 
 func NewFiles(config Config) (files *Files) {
@@ -40,11 +59,100 @@ func NewFiles(config Config) (files *Files) {
 		//Position:               position,
 		DefaultMarkdownName:    defaultMarkdownName,
 		DefaultMediaFolderName: mediaRelativePath,
+		MediaStore:             config.MediaStore,
+		SharedMediaPath:        config.SharedMediaPath,
+		ImagePublicLink:        config.ImagePublicLink,
+		MediaUploadPath:        config.MediaUploadPath,
+		MediaConcurrency:       config.MediaConcurrency,
+		BookmarkImages:         config.BookmarkImages,
+		queue:                  newMediaQueue(),
+		storage:                LocalStorage{},
+	}
+	if files.SharedMediaPath == "" {
+		files.SharedMediaPath = defaultSharedMediaPath
+	}
+	if files.MediaUploadPath != "" && files.ImagePublicLink == "" && !strings.EqualFold(config.MediaStorage, MediaStorageS3) {
+		fmt.Println("⚠ mediaUploadPath needs imagePublicLink to link the media, ignoring it")
+		files.MediaUploadPath = ""
 	}
 	files.MediaPath = filepath.Join(config.HomePath, files.Position, mediaRelativePath)
+	files.media = loadMediaIndex(filepath.Join(config.HomePath, mediaIndexName))
+	files.bookmarks = loadBookmarks(filepath.Join(config.HomePath, bookmarkCacheName),
+		time.Duration(config.BookmarkTTL)*time.Hour, time.Duration(config.BookmarkTimeout)*time.Second)
+	files.downloader = NewDownloader(time.Duration(config.DownloadTimeout)*time.Second, int64(config.MaxMediaSize)<<20)
 	return
 }
 
+// SetStorage publishes the media to storage. Remote storages get the media
+// staged outside the content and linked from their public url, unless
+// ImagePublicLink puts a CDN in front of them.
+func (files *Files) SetStorage(storage MediaStorage) {
+	files.storage = storage
+	remote, ok := storage.(*S3Storage)
+	if !ok {
+		return
+	}
+	if files.MediaUploadPath == "" {
+		files.MediaUploadPath = defaultS3StagingPath
+	}
+	if files.ImagePublicLink == "" {
+		files.ImagePublicLink = remote.PublicURL()
+	}
+}
+
+// SetImageOptimizer optimizes the downloaded images, see NewImageOptimizer
+func (files *Files) SetImageOptimizer(images *ImageOptimizer) {
+	files.images = images
+}
+
+// SaveMediaIndex persists which media were downloaded, see mediaIndex, and
+// the bookmark metadata.
+func (files *Files) SaveMediaIndex() error {
+	if err := files.bookmarks.save(); err != nil {
+		return err
+	}
+	return files.media.save()
+}
+
+// mediaDir folder media are saved to, and the path markdown links them with
+func (files *Files) mediaDir() (dir, link string) {
+	switch {
+	case files.MediaUploadPath != "":
+		dir = files.MediaUploadPath
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(files.HomePath, dir)
+		}
+		// the upload folder is synced as is to the public link
+		return dir, strings.TrimSuffix(files.ImagePublicLink, "/")
+	case files.MediaStore == mediaStoreShared:
+		dir = filepath.Join(files.HomePath, files.SharedMediaPath)
+		link = "/" + strings.TrimPrefix(filepath.ToSlash(filepath.Clean(files.SharedMediaPath)), "static/")
+	default:
+		dir, link = files.MediaPath, files.DefaultMediaFolderName
+	}
+	if files.ImagePublicLink != "" {
+		link = files.publicLink(dir)
+	}
+	return dir, link
+}
+
+// publicLink ImagePublicLink + the path hugo serves dir from
+func (files *Files) publicLink(dir string) string {
+	base := strings.TrimSuffix(files.ImagePublicLink, "/")
+	rel, err := filepath.Rel(files.HomePath, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return base
+	}
+	rel = filepath.ToSlash(rel)
+	for _, root := range []string{"content/", "static/"} {
+		rel = strings.TrimPrefix(rel, root)
+	}
+	if rel == "." {
+		return base
+	}
+	return base + "/" + rel
+}
+
 func (files *Files) mkdirHomePath() error {
 	return os.MkdirAll(files.HomePath, os.FileMode(files.Permission))
 }
@@ -73,22 +181,40 @@ func (ns *NotionSite) getArticleFolderPath() string {
 		folderName = strings.TrimSpace(ns.currentPageProp.Slug)
 	} else {
 		// 回退到使用标题，并进行 URL 友好化处理
-		folderName = strings.ReplaceAll(
-			strings.ToValidUTF8(
-				strings.ToLower(strings.TrimSpace(ns.currentPageProp.Name)),
-				"",
-			),
-			" ", "-",
-		)
-	}
-	
-	if ns.config.GroupByMonth {
-		return filepath.Join(ns.currentPageProp.CreateAt.Format(time.DateOnly), folderName)
+		folderName = folderNameOf(ns.currentPageProp.Name)
+	}
+	// translations go into one bundle
+	if ns.currentPageProp.TranslationKey != "" {
+		folderName = ns.currentPageProp.TranslationKey
+	}
+	// page tree root is rendered into the position folder itself
+	if ns.currentPageProp.IsTreeRoot {
+		return ""
+	}
+
+	if ns.config.GroupByMonth && ns.currentSource.Type != SourceTypePage {
+		createAt := ns.currentPageProp.CreateAt
+		// translations created another day still share the bundle
+		if ns.currentPageProp.TranslationCreateAt != nil {
+			createAt = ns.currentPageProp.TranslationCreateAt
+		}
+		return filepath.Join(createAt.Format(time.DateOnly), folderName)
 	}
 
 	return folderName
 }
 
+// folderNameOf url friendly folder name of a page title
+func folderNameOf(name string) string {
+	return strings.ReplaceAll(
+		strings.ToValidUTF8(
+			strings.ToLower(strings.TrimSpace(name)),
+			"",
+		),
+		" ", "-",
+	)
+}
+
 func (ns *NotionSite) getFilename() string {
 	filename := ns.currentPageProp.GetFileName()
 	name := strings.ReplaceAll(
@@ -114,15 +240,10 @@ func (ns *NotionSite) SetFileInfo(position string) {
 	} else {
 		// 非 setting 类型：都使用 bundle 模式 - 创建文件夹
 		articleFolderPath := ns.getArticleFolderPath()
-		
-		if ns.currentPageProp.IsCustomNameFile {
-			// 有自定义文件名的情况：放在 bundle 文件夹中，使用自定义名称
-			ns.files.FileName = filepath.Join(articleFolderPath, ns.getFilename())
-		} else {
-			// 默认情况：使用 index.md
-			ns.files.FileName = filepath.Join(articleFolderPath, defaultMarkdownName)
-		}
-		
+
+		// 自定义文件名或 index.md / _index.md，见 getActualFileName
+		ns.files.FileName = filepath.Join(articleFolderPath, ns.getActualFileName())
+
 		ns.files.MediaPath = filepath.Join(ns.config.HomePath, ns.files.Position, articleFolderPath, mediaRelativePath)
 		ns.files.FileFolderPath = filepath.Join(ns.config.HomePath, ns.files.Position, articleFolderPath)
 		ns.files.FilePath = filepath.Join(ns.files.FileFolderPath, ns.getActualFileName())
@@ -131,29 +252,25 @@ func (ns *NotionSite) SetFileInfo(position string) {
 
 // 获取实际的文件名（不包含路径）
 func (ns *NotionSite) getActualFileName() string {
+	lang := ns.currentPageProp.Language
 	if ns.currentPageProp.IsCustomNameFile {
-		return ns.getFilename()
+		return languageFileName(ns.getFilename(), lang)
+	}
+	if ns.currentPageProp.IsSection {
+		return languageFileName(sectionMarkdownName, lang)
 	}
-	return defaultMarkdownName
+	return languageFileName(defaultMarkdownName, lang)
 }
 
 func (files *Files) DownloadMedia(dynamicMedia any) error {
 
+	// only registered here, FlushMedia downloads and ResolveMedia sets the real path
 	download := func(imgURL string) (string, error) {
-		var savePath string
-		savePath = files.MediaPath
-		resp, err := http.Get(imgURL)
-		if err != nil {
-			return "", err
-		}
-
-		imgFilename, err := files.saveTo(resp.Body, imgURL, savePath)
-		if err != nil {
-			return "", err
+		var blockID string
+		if block, ok := dynamicMedia.(notion.Block); ok {
+			blockID = block.ID()
 		}
-		var convertWinPath = strings.ReplaceAll(filepath.Join(files.DefaultMediaFolderName, imgFilename), "\\", "/")
-
-		return convertWinPath, nil
+		return files.enqueueMedia(imgURL, mediaKey(dynamicMedia, imgURL), blockID), nil
 	}
 
 	var err error
@@ -209,32 +326,73 @@ func (files *Files) DownloadMedia(dynamicMedia any) error {
 
 }
 
-func (files *Files) saveTo(reader io.Reader, rawURL, distDir string) (string, error) {
-	u, err := url.Parse(rawURL)
-	if err != nil {
-		return "", fmt.Errorf("malformed url: %s", err)
+// storeMedia save the media into dir and returns its index entry. Media already
+// in the index are reused, copied from where they were saved last time if needed.
+func (files *Files) storeMedia(rawURL, key, dir string) (mediaEntry, error) {
+	if files.images.Enabled() {
+		key += "#" + files.images.variant()
 	}
-
-	// gen file name
-	splitPaths := strings.Split(u.Path, "/")
-	imageFilename := splitPaths[len(splitPaths)-1]
-	if strings.HasPrefix(imageFilename, "Untitled.") {
-		imageFilename = splitPaths[len(splitPaths)-2] + filepath.Ext(u.Path)
+	if entry, ok := files.media.get(key); ok {
+		dst := filepath.Join(dir, entry.Name)
+		if _, err := os.Stat(dst); err == nil {
+			if files.plan != nil {
+				files.plan.UseFile(dst)
+				return entry, nil
+			}
+			return files.publishMedia(key, dir, entry)
+		}
+		if _, err := os.Stat(entry.Path); err == nil {
+			if files.plan != nil {
+				return entry, nil
+			}
+			if err := files.mkdirPath(dir); err != nil {
+				return mediaEntry{}, err
+			}
+			if err := files.copyFile(entry.Path, dst); err != nil {
+				return mediaEntry{}, err
+			}
+			entry.Path = dst
+			entry.Published = ""
+			return files.publishMedia(key, dir, entry)
+		}
 	}
-
-	if err := os.MkdirAll(distDir, 0755); err != nil {
-		return "", fmt.Errorf("%s: %s", distDir, err)
+	if files.Offline {
+		return mediaEntry{}, fmt.Errorf("offline: media %s was never downloaded", rawURL)
+	}
+	if files.plan != nil {
+		prefix, ext, err := mediaPrefix(rawURL)
+		if err != nil {
+			return mediaEntry{}, err
+		}
+		files.plan.AddMedia(rawURL, filepath.Join(dir, prefix+"-<hash>"+ext))
+		return mediaEntry{Name: prefix + ext}, nil
 	}
 
-	filename := fmt.Sprintf("%s_%s", u.Hostname(), imageFilename)
-	out, err := os.Create(filepath.Join(distDir, filename))
+	name, err := files.downloader.Download(rawURL, dir)
 	if err != nil {
-		return "", fmt.Errorf("couldn't create image file: %s", err)
+		return mediaEntry{}, err
+	}
+	entry := mediaEntry{Name: name, Path: filepath.Join(dir, name)}
+	if files.images.Enabled() {
+		if entry, err = files.images.Optimize(dir, entry.Name); err != nil {
+			return mediaEntry{}, err
+		}
 	}
-	defer out.Close()
+	return files.publishMedia(key, dir, entry)
+}
 
-	_, err = io.Copy(out, reader)
-	return filename, err
+// publishMedia publishes dir/entry.Name, unless it already was to the
+// current storage location, and records the entry in the index
+func (files *Files) publishMedia(key, dir string, entry mediaEntry) (mediaEntry, error) {
+	location := storageLocation(files.storage)
+	if entry.Published != location {
+		if err := files.storage.Publish(dir, entry.Name); err != nil {
+			return mediaEntry{}, err
+		}
+		entry.Published = location
+	}
+	files.media.set(key, entry)
+	return entry, nil
 }
 
 func (files *Files) copyDir(src, dst string) error {
@@ -1,14 +1,18 @@
 package pkg
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/dstotijn/go-notion"
 	"github.com/gohugoio/hugo/common/paths"
 	"log"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 type NotionSite struct {
@@ -19,32 +23,130 @@ type NotionSite struct {
 	currentPage     notion.Page
 	currentPageProp *NotionProp
 	currentBlocks   []notion.Block
-	caches          []*NotionCache
+	caches          *NotionCaches
+	plan            *Plan
+	currentSource   Source
+	currentTreeNode *pageTreeNode
+	currentParent   *NotionCache
+	// databasePages pages of the current database query by id
+	databasePages map[string]notion.Page
+	summaries     []*SourceSummary
+	translator    Translator
+	// bundles rendered pages by bundle, for the translations missing
+	bundles    map[string]*translationBundle
+	bundleKeys []string
 }
 
-func NewNotionSite(api *NotionAPI, tm *ToMarkdown, files *Files, config Config, caches []*NotionCache) *NotionSite {
+// pageTreeNode is where a page of a page tree source goes
+type pageTreeNode struct {
+	Position  string
+	Weight    int
+	IsRoot    bool
+	IsSection bool
+	// Children ids of the child pages walked into the folder of this page
+	Children []string
+	// ChildLinks relative links to the folders the children were written to
+	ChildLinks map[string]string
+	// Folder the page was written to, empty when it failed
+	Folder string
+}
+
+// SourceSummary counts what happened to the pages of one source.
+type SourceSummary struct {
+	Name          string
+	Pages         int
+	Generated     int
+	Failed        int
+	StatusChanged int
+}
+
+func (s *SourceSummary) String() string {
+	return fmt.Sprintf("%s: %d pages, %d generated, %d failed, %d status changed",
+		s.Name, s.Pages, s.Generated, s.Failed, s.StatusChanged)
+}
+
+func NewNotionSite(api *NotionAPI, tm *ToMarkdown, files *Files, config Config, caches *NotionCaches) *NotionSite {
+	if config.MaxDepth > 0 {
+		caches.MaxDepth = config.MaxDepth
+	}
+	if config.OGCard {
+		card, err := NewOGCard(config.OGCardFont)
+		if err != nil {
+			fmt.Println("⚠ Og cards disabled:", err)
+		}
+		tm.OGCard = card
+	}
 	return &NotionSite{api: api, tm: tm, files: files, config: config, caches: caches}
 }
 
-func Run(ns *NotionSite) error {
-	fmt.Printf("init save path %s", ns.files.HomePath)
-	if err := ns.files.mkdirHomePath(); err != nil {
-		return fmt.Errorf("couldn't create content folder: %s", err)
+// EnableDryRun renders everything into memory and records a Plan instead of
+// writing files, downloading media or updating Notion pages.
+func (ns *NotionSite) EnableDryRun() {
+	ns.plan = NewPlan()
+	ns.files.plan = ns.plan
+}
+
+// Plan returns the dry run plan, nil when dry run is disabled.
+func (ns *NotionSite) Plan() *Plan {
+	return ns.plan
+}
+
+// SetTranslator machine translates the pages missing a language, see
+// Markdown.Translation
+func (ns *NotionSite) SetTranslator(translator Translator) {
+	ns.translator = translator
+}
+
+// writeFile replaces path with content through a temp file, an interrupted
+// write never leaves a truncated file behind
+func (ns *NotionSite) writeFile(path string, content []byte) error {
+	if ns.plan != nil {
+		ns.plan.AddFile(path, content)
+		return nil
 	}
-	var fms []*FrontMatter
-	// find and process database page
-	fms, err := processDatabase(ns, ns.config.DatabaseID)
+	out, err := os.CreateTemp(filepath.Dir(path), ".write-*")
 	if err != nil {
 		return err
 	}
-	for _, cache := range ns.caches {
-		//ns.files.MediaPath = cache.ParentFilesInfo.MediaPath
-		tmps, err := processDatabase(ns, cache.ChildDatabaseId)
+	defer os.Remove(out.Name())
+	_, err = out.Write(content)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), path)
+}
+
+func Run(ns *NotionSite) error {
+	fmt.Printf("init save path %s", ns.files.HomePath)
+	if ns.plan == nil {
+		if err := ns.files.mkdirHomePath(); err != nil {
+			return fmt.Errorf("couldn't create content folder: %s", err)
+		}
+	}
+	var fms []*FrontMatter
+	var errs []error
+	sources := ns.config.GetSources()
+	for _, source := range sources {
+		tmps, err := processSource(ns, source)
 		if err != nil {
-			fmt.Errorf("process child database erro but continu %s", err)
+			log.Printf("❌ Processing source %s: %s\n", source.Name, err)
+			errs = append(errs, fmt.Errorf("source %s: %w", source.Name, err))
 		}
 		fms = append(fms, tmps...)
 	}
+	fms = append(fms, ns.translateMissing()...)
+	for _, summary := range ns.summaries {
+		fmt.Println("📊", summary)
+	}
+	if len(fms) == 0 && len(errs) > 0 {
+		return errors.Join(errs...)
+	}
 	// Set GITHUB_ACTIONS info variables : https://docs.github.com/en/actions/learn-github-actions/workflow-commands-for-github-actions
 	if os.Getenv("GITHUB_ACTIONS") == "true" {
 		str := os.Getenv("GITHUB_OUTPUT")
@@ -53,68 +155,144 @@ func Run(ns *NotionSite) error {
 			return err
 		}
 	}
-	fms, err = convertFolderPath(fms)
+	fms, err := convertFolderPath(fms)
 	if err != nil {
 		return err
 	}
+	if ns.plan != nil {
+		ns.plan.AddStale()
+	}
 	fmsBytes, err := json.Marshal(fms)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(ns.files.HomePath+"/content/blogs.json", fmsBytes, 0644)
+	if err := ns.writeFile(ns.files.HomePath+"/content/blogs.json", fmsBytes); err != nil {
+		return err
+	}
+	if ns.plan == nil {
+		if err := ns.files.SaveMediaIndex(); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// processSource renders one configured source and its child databases.
+func processSource(ns *NotionSite, source Source) ([]*FrontMatter, error) {
+	ns.currentSource = source
+	fmt.Printf("-- Source %s --\n", source.Name)
+	if source.Type == SourceTypePage {
+		summary := &SourceSummary{Name: source.Name}
+		ns.summaries = append(ns.summaries, summary)
+		position := source.Position
+		if position == "" {
+			position = defaultPosition
+		}
+		fms, err := processPageTree(ns, summary, source.RootPageID, &pageTreeNode{Position: position, IsRoot: true})
+		tmps, childErr := processChildDatabases(ns)
+		return append(fms, tmps...), errors.Join(err, childErr)
+	}
+	// find and process database page
+	fms, err := processDatabase(ns, source.DatabaseID)
+	if err != nil {
+		return nil, err
+	}
+	tmps, err := processChildDatabases(ns)
+	return append(fms, tmps...), err
+}
+
+// processChildDatabases renders the child databases found while rendering the
+// current source, nested under their parent page
+func processChildDatabases(ns *NotionSite) ([]*FrontMatter, error) {
+	var fms []*FrontMatter
+	var errs []error
+	for cache := ns.caches.Next(); cache != nil; cache = ns.caches.Next() {
+		ns.currentParent = cache
+		tmps, err := processDatabase(ns, cache.ChildDatabaseId)
+		ns.currentParent = nil
+		if err != nil {
+			log.Printf("❌ Processing child database %s: %s\n", cache.ChildDatabaseId, err)
+			errs = append(errs, fmt.Errorf("child database %s: %w", cache.ChildDatabaseId, err))
+		}
+		fms = append(fms, tmps...)
+	}
+	return fms, errors.Join(errs...)
 }
 
 func convertFolderPath(fms []*FrontMatter) ([]*FrontMatter, error) {
 	for _, fm := range fms {
-		path := fm.Title
-		if fm.Slug != "" {
-			path = fm.Slug
+		// machine translations already have the path of their source page
+		if fm.MachineTranslated {
+			continue
 		}
-
-		// https://github.com/gohugoio/hugo/blob/master/helpers/url.go#L41
-		path = strings.ToLower(strings.ReplaceAll(path, " ", "-"))
-		parsedURI, err := url.Parse(path)
+		path, err := accessPath(fm)
 		if err != nil {
 			return nil, err
 		}
-
-		// https://github.com/gohugoio/hugo/blob/master/helpers/path.go#L59
-		fm.AccessPath = paths.Sanitize(parsedURI.String())
+		fm.AccessPath = path
 	}
 	return fms, nil
 }
 
+// accessPath the path hugo serves the page from, after its slug else title
+func accessPath(fm *FrontMatter) (string, error) {
+	path := fm.Title
+	if fm.Slug != "" {
+		path = fm.Slug
+	}
+
+	// https://github.com/gohugoio/hugo/blob/master/helpers/url.go#L41
+	path = strings.ToLower(strings.ReplaceAll(path, " ", "-"))
+	parsedURI, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+
+	// https://github.com/gohugoio/hugo/blob/master/helpers/path.go#L59
+	return paths.Sanitize(parsedURI.String()), nil
+}
+
 func generate(ns *NotionSite, page notion.Page, blocks []notion.Block) (*FrontMatter, error) {
 	// Generate markdown content to the file
 	initNotionSite(ns, page, blocks)
 
-	if ns.api.CheckHasChildDataBase(blocks, func(b bool, id string) {
-		// cache child database block id
-		if b {
-			ns.caches = append(ns.caches, &NotionCache{
-				ParentFilesInfo: ns.files,
-				ParentPropInfo:  ns.currentPageProp,
-				ChildDatabaseId: id,
-			})
-		}
-	}) {
-		return nil, nil
+	if ns.plan == nil {
+		ns.files.mkdirPath(ns.files.FileFolderPath)
+	} else {
+		ns.plan.AddPosition(filepath.Join(ns.config.HomePath, ns.files.Position))
 	}
 
-	ns.files.mkdirPath(ns.files.FileFolderPath)
-
+	ns.tm.Flavor = ns.currentSource.Flavor
+	ns.tm.ImageFigure = ns.config.ImageFigure
+	ns.tm.ImageLinkOriginal = ns.config.ImageLinkOriginal
+	ns.tm.FrontMatterFiles = ns.config.FrontMatterFiles
+	ns.tm.CoverKey = ns.config.CoverKey
+	ns.tm.IconKey = ns.config.IconKey
+	ns.tm.CommentsMode = ns.config.Comments
+	ns.tm.SummaryBreak = ns.config.SummaryBreak
+	ns.tm.SummaryLength = ns.config.SummaryLength
 	if !ns.currentPageProp.IsSetting() {
 		ns.tm.ContentTemplate = ns.config.Template
 		ns.tm.WithFrontMatter(ns.currentPage)
+		ns.tm.FrontMatterDefaults = ns.frontMatterDefaults()
+		if key := ns.currentPageProp.TranslationKey; key != "" {
+			setFrontMatterDefault(ns.tm.FrontMatter, "TranslationKey", key)
+		}
+		if ns.currentTreeNode != nil {
+			ns.tm.FrontMatter["Weight"] = ns.currentTreeNode.Weight
+		}
 	}
-	var err error
-	// save current io
-	if !ns.currentPageProp.IsFolder() {
-		ns.files.currentWriter, err = os.Create(ns.files.FilePath)
+	ns.tm.TreeChildren = nil
+	if ns.currentTreeNode != nil {
+		ns.tm.TreeChildren = ns.currentTreeNode.ChildLinks
 	}
-
-	if err != nil {
-		return nil, fmt.Errorf("error create file: %s", err)
+	ns.cacheChildDatabases(blocks)
+	ns.tm.Discussions = nil
+	// the page is rendered in memory, the last good file stays when rendering fails
+	var content *bytes.Buffer
+	if !ns.currentPageProp.IsFolder() {
+		content = new(bytes.Buffer)
+		ns.files.currentWriter = content
 	}
 
 	// todo edit frontMatter
@@ -124,7 +302,97 @@ func generate(ns *NotionSite, page notion.Page, blocks []notion.Block) (*FrontMa
 
 	//// todo how to support mention feature ???
 
-	return ns.tm.GenerateTo(ns)
+	fm, err := ns.tm.GenerateTo(ns)
+	if fm != nil {
+		fm.Language = ns.currentPageProp.Language
+	}
+	if err == nil && content != nil {
+		if err = ns.writeFile(ns.files.FilePath, content.Bytes()); err != nil {
+			err = fmt.Errorf("error write file: %s", err)
+		}
+	}
+	if err != nil && ns.plan != nil {
+		ns.plan.KeepDir(ns.files.FileFolderPath)
+		ns.plan.UseFile(ns.files.FilePath)
+	}
+	if err == nil && content != nil && fm != nil && fm.Language != "" && ns.translator != nil {
+		ns.recordTranslation(fm, content.Bytes())
+	}
+	return fm, err
+}
+
+// front matter keys that identify a page, never inherited from the parent page
+var nonInheritableKeys = []string{"title", "slug", "url", "aliases", "weight", "description",
+	"metaTitle", "metaDescription", "lastMod", "createAt", "expiryDate", "accessPath", "translationKey", "language"}
+
+// nonInheritableKeys and the configured cover and icon keys
+func (ns *NotionSite) nonInheritableKeys() []string {
+	cover, icon := ns.config.CoverKey, ns.config.IconKey
+	if cover == "" {
+		cover = defaultCoverKey
+	}
+	if icon == "" {
+		icon = defaultIconKey
+	}
+	return append([]string{cover, icon}, nonInheritableKeys...)
+}
+
+// frontMatterDefaults source defaults and, for child database pages, the parent page front matter
+func (ns *NotionSite) frontMatterDefaults() map[string]any {
+	defaults := make(map[string]any)
+	for key, value := range ns.currentSource.FrontMatter {
+		defaults[key] = value
+	}
+	for key, value := range ns.config.LanguageFrontMatter[ns.currentPageProp.Language] {
+		defaults[key] = value
+	}
+	if ns.currentParent == nil {
+		return defaults
+	}
+	keys := ns.nonInheritableKeys()
+	for key, value := range ns.currentParent.ParentFrontMatter {
+		inheritable := true
+		for _, k := range keys {
+			if strings.EqualFold(k, key) {
+				inheritable = false
+				break
+			}
+		}
+		if inheritable {
+			setFrontMatterDefault(defaults, key, value)
+		}
+	}
+	return defaults
+}
+
+// cacheChildDatabases queue the child databases of the current page
+func (ns *NotionSite) cacheChildDatabases(blocks []notion.Block) {
+	depth := 1
+	if ns.currentParent != nil {
+		depth = ns.currentParent.Depth + 1
+	}
+	ns.api.CheckHasChildDataBase(blocks, func(id string) {
+		position, err := filepath.Rel(ns.config.HomePath, ns.files.FileFolderPath)
+		if err != nil {
+			position = ns.currentPageProp.Position
+		}
+		parentFrontMatter := make(map[string]any)
+		for key, value := range ns.tm.FrontMatter {
+			parentFrontMatter[key] = value
+		}
+		for key, value := range ns.tm.FrontMatterDefaults {
+			setFrontMatterDefault(parentFrontMatter, key, value)
+		}
+		if !ns.caches.SetCache(&NotionCache{
+			ParentPropInfo:    ns.currentPageProp,
+			ParentFrontMatter: parentFrontMatter,
+			ParentPosition:    position,
+			ChildDatabaseId:   id,
+			Depth:             depth,
+		}) {
+			fmt.Printf("⚠ Skip child database %s: already processed or deeper than %d\n", id, ns.caches.MaxDepth)
+		}
+	})
 }
 
 func initNotionSite(ns *NotionSite, page notion.Page, blocks []notion.Block) {
@@ -132,6 +400,20 @@ func initNotionSite(ns *NotionSite, page notion.Page, blocks []notion.Block) {
 	ns.currentPage = page
 	// set current notion page prop
 	ns.currentPageProp = NewNotionProp(ns.currentPage)
+	// pages without their own position go to the source section
+	if ns.currentSource.Position != "" && getSelect(page, PositionProp) == "" {
+		ns.currentPageProp.Position = ns.currentSource.Position
+	}
+	// child database pages go into the parent page folder
+	if ns.currentParent != nil && getSelect(page, PositionProp) == "" {
+		ns.currentPageProp.Position = ns.currentParent.ParentPosition
+	}
+	if node := ns.currentTreeNode; node != nil {
+		ns.currentPageProp.Position = node.Position
+		ns.currentPageProp.IsTreeRoot = node.IsRoot
+		ns.currentPageProp.IsSection = node.IsSection
+	}
+	ns.initLanguage(page)
 	ns.SetFileInfo(ns.currentPageProp.Position)
 	// set notion site files info
 	ns.tm.NotionProps = ns.currentPageProp
@@ -141,19 +423,36 @@ func initNotionSite(ns *NotionSite, page notion.Page, blocks []notion.Block) {
 
 func processDatabase(ns *NotionSite, id string) ([]*FrontMatter, error) {
 	var fms []*FrontMatter
-	q, err := ns.api.queryDatabase(ns.api.Client, ns.config.Notion, id)
+	config := ns.currentSource.NotionConfig(ns.config.Notion)
+	summary := &SourceSummary{Name: ns.currentSource.Name}
+	if id != ns.currentSource.DatabaseID {
+		summary.Name += " > " + id
+	}
+	ns.summaries = append(ns.summaries, summary)
+	q, err := ns.api.queryDatabase(ns.api.Client, config, id)
 	if err != nil {
+		if ns.plan != nil {
+			ns.plan.AddFailure("query database %s: %s", id, err)
+		}
 		return fms, fmt.Errorf("❌ Querying Notion database: %s", err)
 	}
 	fmt.Println("✔ Querying Notion database: Completed")
+	summary.Pages = len(q.Results)
+	ns.databasePages = make(map[string]notion.Page, len(q.Results))
+	for _, page := range q.Results {
+		ns.databasePages[page.ID] = page
+	}
 	// fetch page children
-	//changed = 0 // number of article status changed
 	for i, page := range q.Results {
 		fmt.Printf("-- Article [%d/%d] -- %s \n", i+1, len(q.Results), page.URL)
 		// Get page blocks tree
-		blocks, err := ns.api.queryBlockChildren(ns.api.Client, page.ID)
+		blocks, err := ns.api.queryBlockChildren(ns.api.Client, page.ID, page.LastEditedTime.Format(time.RFC3339Nano))
 		if err != nil {
 			log.Println("❌ Getting blocks tree:", err)
+			summary.Failed++
+			if ns.plan != nil {
+				ns.plan.AddFailure("get blocks of %s: %s", page.URL, err)
+			}
 			continue
 		}
 		fmt.Println("✔ Getting blocks tree: Completed")
@@ -162,16 +461,101 @@ func processDatabase(ns *NotionSite, id string) ([]*FrontMatter, error) {
 		fm, err := generate(ns, page, blocks)
 		if err != nil {
 			fmt.Println("❌ Generating blog post:", err)
+			summary.Failed++
+			if ns.plan != nil {
+				ns.plan.AddFailure("generate %s: %s", page.URL, err)
+			}
 			continue
 		}
 		if fm != nil {
+			fm.Source = ns.currentSource.Name
 			fms = append(fms, fm)
 		}
+		summary.Generated++
 		fmt.Println("✔ Generating blog post: Completed")
 		// Change status of blog post if desired
-		if ns.api.changeStatus(ns.api.Client, page, ns.config.Notion) {
-			//changed++
+		if ns.plan != nil {
+			if from, ok := ns.api.needChangeStatus(page, config); ok {
+				ns.plan.AddStatusChange(page.ID, ns.currentPageProp.GetTitle(), from, config.PublishedValue)
+				summary.StatusChanged++
+			}
+			continue
+		}
+		if ns.api.changeStatus(ns.api.Client, page, config) {
+			summary.StatusChanged++
 		}
 	}
 	return fms, nil
 }
+
+// processPageTree renders a page and walks its child pages recursively. Pages
+// with child pages become sections (_index.md), the others page bundles.
+func processPageTree(ns *NotionSite, summary *SourceSummary, pageID string, node *pageTreeNode) ([]*FrontMatter, error) {
+	var fms []*FrontMatter
+	page, err := ns.api.findPage(ns.api.Client, pageID)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Fetching page %s: %s", pageID, err)
+	}
+	summary.Pages++
+	fmt.Printf("-- Page -- %s \n", page.URL)
+	blocks, err := ns.api.queryBlockChildren(ns.api.Client, page.ID, page.LastEditedTime.Format(time.RFC3339Nano))
+	if err != nil {
+		summary.Failed++
+		if ns.plan != nil {
+			ns.plan.AddFailure("get blocks of %s: %s", page.URL, err)
+		}
+		return nil, fmt.Errorf("❌ Getting blocks tree of %s: %s", page.URL, err)
+	}
+	var children []string
+	for _, block := range blocks {
+		if child, ok := block.(*notion.ChildPageBlock); ok {
+			children = append(children, child.ID())
+		}
+	}
+	node.IsSection = len(children) > 0
+	node.Children = children
+
+	// children go into the folder of this page. They are rendered first, the
+	// page links to the folders they were really written to.
+	ns.currentTreeNode = node
+	initNotionSite(ns, page, blocks)
+	ns.currentTreeNode = nil
+	folder := ns.files.FileFolderPath
+	position, err := filepath.Rel(ns.config.HomePath, folder)
+	if err != nil {
+		return nil, err
+	}
+	var childFms []*FrontMatter
+	node.ChildLinks = make(map[string]string)
+	for i, child := range children {
+		childNode := &pageTreeNode{Position: position, Weight: i + 1}
+		tmps, err := processPageTree(ns, summary, child, childNode)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		childFms = append(childFms, tmps...)
+		if link, err := filepath.Rel(folder, childNode.Folder); childNode.Folder != "" && err == nil {
+			node.ChildLinks[child] = filepath.ToSlash(link) + "/"
+		}
+	}
+
+	ns.currentTreeNode = node
+	fm, err := generate(ns, page, blocks)
+	ns.currentTreeNode = nil
+	if err != nil {
+		fmt.Println("❌ Generating page:", err)
+		summary.Failed++
+		if ns.plan != nil {
+			ns.plan.AddFailure("generate %s: %s", page.URL, err)
+		}
+	} else {
+		node.Folder = ns.files.FileFolderPath
+		summary.Generated++
+		if fm != nil {
+			fm.Source = ns.currentSource.Name
+			fms = append(fms, fm)
+		}
+	}
+	return append(fms, childFms...), nil
+}
@@ -0,0 +1,112 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestGenerateKeepsPageOnFailure(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	config := Config{Markdown: Markdown{HomePath: t.TempDir()}}
+	ns := NewNotionSite(&NotionAPI{}, New(), NewFiles(config), config, NewNotionCaches())
+	ns.currentSource = Source{Position: "post"}
+	page := notion.Page{ID: "p1", Properties: notion.DatabasePageProperties{
+		nameProp: {Type: notion.DBPropTypeTitle, Title: []notion.RichText{{PlainText: "hello", Text: &notion.Text{Content: "hello"}}}},
+	}}
+	blocks := []notion.Block{&notion.ImageBlock{Type: notion.FileTypeExternal, External: &notion.FileExternal{URL: server.URL + "/missing.png"}}}
+
+	if _, err := generate(ns, page, nil); err != nil {
+		t.Fatal(err)
+	}
+	good, err := os.ReadFile(ns.files.FilePath)
+	if err != nil || len(good) == 0 {
+		t.Fatalf("got %q, %v", good, err)
+	}
+	// the media download fails, the last good page stays
+	if _, err := generate(ns, page, blocks); err == nil {
+		t.Fatal("missing image not reported")
+	}
+	if got, _ := os.ReadFile(ns.files.FilePath); string(got) != string(good) {
+		t.Errorf("page overwritten with %q", got)
+	}
+}
+
+func TestChildDatabaseFrontMatter(t *testing.T) {
+	ns := &NotionSite{currentPageProp: &NotionProp{}, currentParent: &NotionCache{ParentFrontMatter: map[string]any{
+		"Title": "parent", "TranslationKey": "parent", "Language": "en", "Tags": []string{"go"},
+	}}}
+	defaults := ns.frontMatterDefaults()
+	if len(defaults) != 1 || defaults["Tags"] == nil {
+		t.Errorf("got %v, only the tags are inherited", defaults)
+	}
+
+	// the cover and icon under their configured keys
+	ns.config.CoverKey, ns.config.IconKey = "featuredImage", "emoji"
+	ns.currentParent.ParentFrontMatter = map[string]any{"featuredImage": "media/a.png", "emoji": "🚀", "image": "kept"}
+	if defaults := ns.frontMatterDefaults(); len(defaults) != 1 || defaults["image"] != "kept" {
+		t.Errorf("got %v, the cover and icon are inherited", defaults)
+	}
+}
+
+// treeStub answers the Notion pages and block children of a page tree
+type treeStub map[string]string
+
+func (s treeStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	if body, ok := s[req.URL.Path]; ok {
+		rec.Header().Set("Content-Type", "application/json")
+		rec.WriteString(body)
+	} else {
+		rec.WriteHeader(http.StatusNotFound)
+		rec.WriteString(`{"object": "error", "status": 404, "code": "object_not_found", "message": "not found"}`)
+	}
+	return rec.Result(), nil
+}
+
+func treePage(id, title string) string {
+	return `{"object": "page", "id": "` + id + `", "created_time": "2024-01-02T00:00:00Z", "last_edited_time": "2024-01-02T00:00:00Z",
+		"parent": {"type": "workspace", "workspace": true}, "properties": {"title": {"id": "title", "type": "title", "title": [` + title + `]}}}`
+}
+
+func TestPageTreeChildLinks(t *testing.T) {
+	bold := `{"type": "text", "text": {"content": "Getting"}, "annotations": {"bold": true}, "plain_text": "Getting"},
+		{"type": "text", "text": {"content": " Started"}, "plain_text": " Started"}`
+	stub := treeStub{
+		"/v1/pages/root": treePage("root", `{"type": "text", "text": {"content": "Docs"}, "plain_text": "Docs"}`),
+		"/v1/blocks/root/children": `{"object": "list", "results": [
+			{"object": "block", "id": "c1", "type": "child_page", "child_page": {"title": "Getting Started"}},
+			{"object": "block", "id": "c2", "type": "child_page", "child_page": {"title": "Broken"}}]}`,
+		"/v1/pages/c1":           treePage("c1", bold),
+		"/v1/blocks/c1/children": `{"object": "list", "results": []}`,
+		// c2 has no blocks endpoint and fails
+		"/v1/pages/c2": treePage("c2", `{"type": "text", "text": {"content": "Broken"}, "plain_text": "Broken"}`),
+	}
+	home := t.TempDir()
+	config := Config{Markdown: Markdown{HomePath: home}}
+	api := &NotionAPI{Client: notion.NewClient("secret", notion.WithHTTPClient(&http.Client{Transport: stub}))}
+	ns := NewNotionSite(api, New(), NewFiles(config), config, NewNotionCaches())
+	processSource(ns, Source{Name: "docs", Type: SourceTypePage, RootPageID: "root", Position: "content/docs"})
+
+	index, err := os.ReadFile(filepath.Join(home, "content/docs/_index.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := regexp.MustCompile(`\[Getting Started\]\(([^)]*)\)`).FindSubmatch(index)
+	if link == nil {
+		t.Fatalf("no link to the child page in %s", index)
+	}
+	if _, err := os.Stat(filepath.Join(home, "content/docs", string(link[1]), "index.md")); err != nil {
+		t.Errorf("dead link %s: %v", link[1], err)
+	}
+	if !strings.Contains(string(index), "- Broken\n") {
+		t.Errorf("the failed child should not be linked: %s", index)
+	}
+}
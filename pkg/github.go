@@ -0,0 +1,92 @@
+package pkg
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const githubIcon = "https://github.com/favicon.ico"
+
+// GitHubRef what a github.com url points to, parsed from the url alone
+type GitHubRef struct {
+	Owner string
+	Repo  string
+	// Kind repo, issue, pull, discussion, commit, release or file
+	Kind   string
+	Number string
+	// Ref commit sha, release tag or file path
+	Ref string
+}
+
+// github.com paths that aren't users or organizations
+var githubReserved = map[string]bool{
+	"orgs": true, "settings": true, "marketplace": true, "topics": true, "features": true,
+	"sponsors": true, "notifications": true, "login": true, "explore": true, "search": true,
+}
+
+func parseGitHubURL(rawURL string) (GitHubRef, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Hostname() != "github.com" && u.Hostname() != "www.github.com") {
+		return GitHubRef{}, false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || githubReserved[parts[0]] {
+		return GitHubRef{}, false
+	}
+	ref := GitHubRef{Owner: parts[0], Repo: strings.TrimSuffix(parts[1], ".git"), Kind: "repo"}
+	if len(parts) < 4 {
+		return ref, true
+	}
+	switch parts[2] {
+	case "issues", "discussions":
+		ref.Kind, ref.Number = strings.TrimSuffix(parts[2], "s"), parts[3]
+	case "pull":
+		ref.Kind, ref.Number = "pull", parts[3]
+	case "commit":
+		ref.Kind, ref.Ref = "commit", parts[3]
+	case "releases":
+		if len(parts) > 4 && parts[3] == "tag" {
+			ref.Kind, ref.Ref = "release", parts[4]
+		}
+	case "blob", "tree":
+		if len(parts) > 4 {
+			ref.Kind, ref.Ref = "file", strings.Join(parts[4:], "/")
+		}
+	}
+	return ref, true
+}
+
+// Title like GitHub shows the reference
+func (ref GitHubRef) Title() string {
+	repo := ref.Owner + "/" + ref.Repo
+	switch ref.Kind {
+	case "issue", "pull", "discussion":
+		return fmt.Sprintf("%s#%s", repo, ref.Number)
+	case "commit":
+		return fmt.Sprintf("%s@%s", repo, ref.Ref[:min(7, len(ref.Ref))])
+	case "release":
+		return fmt.Sprintf("%s %s", repo, ref.Ref)
+	case "file":
+		return fmt.Sprintf("%s/%s", repo, ref.Ref)
+	}
+	return repo
+}
+
+func (ref GitHubRef) Description() string {
+	switch ref.Kind {
+	case "issue":
+		return "Issue #" + ref.Number
+	case "pull":
+		return "Pull request #" + ref.Number
+	case "discussion":
+		return "Discussion #" + ref.Number
+	case "commit":
+		return "Commit " + ref.Ref
+	case "release":
+		return "Release " + ref.Ref
+	case "file":
+		return "File in " + ref.Owner + "/" + ref.Repo
+	}
+	return "Repository on GitHub"
+}
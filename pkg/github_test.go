@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestParseGitHubURL(t *testing.T) {
+	cases := []struct {
+		url   string
+		want  GitHubRef
+		title string
+	}{
+		{"https://github.com/nonacosa/notion-site", GitHubRef{Owner: "nonacosa", Repo: "notion-site", Kind: "repo"}, "nonacosa/notion-site"},
+		{"https://github.com/nonacosa/notion-site/issues/45", GitHubRef{Owner: "nonacosa", Repo: "notion-site", Kind: "issue", Number: "45"}, "nonacosa/notion-site#45"},
+		{"https://github.com/nonacosa/notion-site/pull/12/files", GitHubRef{Owner: "nonacosa", Repo: "notion-site", Kind: "pull", Number: "12"}, "nonacosa/notion-site#12"},
+		{"https://github.com/golang/go/discussions/7", GitHubRef{Owner: "golang", Repo: "go", Kind: "discussion", Number: "7"}, "golang/go#7"},
+		{"https://github.com/golang/go/commit/0123456789abcdef", GitHubRef{Owner: "golang", Repo: "go", Kind: "commit", Ref: "0123456789abcdef"}, "golang/go@0123456"},
+		{"https://github.com/golang/go/releases/tag/go1.22.0", GitHubRef{Owner: "golang", Repo: "go", Kind: "release", Ref: "go1.22.0"}, "golang/go go1.22.0"},
+		{"https://github.com/golang/go/blob/master/src/fmt/print.go", GitHubRef{Owner: "golang", Repo: "go", Kind: "file", Ref: "src/fmt/print.go"}, "golang/go/src/fmt/print.go"},
+	}
+	for _, c := range cases {
+		ref, ok := parseGitHubURL(c.url)
+		if !ok || ref != c.want || ref.Title() != c.title {
+			t.Errorf("%s: got %+v %q", c.url, ref, ref.Title())
+		}
+	}
+	for _, url := range []string{"https://github.com/nonacosa", "https://github.com/orgs/golang/people", "https://gitlab.com/a/b"} {
+		if ref, ok := parseGitHubURL(url); ok {
+			t.Errorf("%s: should not parse, got %+v", url, ref)
+		}
+	}
+}
+
+func TestLinkPreviewCard(t *testing.T) {
+	tm := New()
+	tm.NotionProps = &NotionProp{}
+	tm.Files = NewFiles(Config{Markdown: Markdown{HomePath: t.TempDir()}})
+	tm.Files.Offline = true
+	cases := []struct {
+		flavor string
+		url    string
+		want   string
+	}{
+		{FlavorHugo, "https://github.com/nonacosa/notion-site/pull/12",
+			"{{< bookmark image=\"\" icon=\"https://github.com/favicon.ico\" url=\"https://github.com/nonacosa/notion-site/pull/12\" title=\"nonacosa/notion-site#12\" description=\"Pull request #12\" >}}\n{{< /bookmark >}}\n"},
+		{FlavorCommonMark, "https://github.com/nonacosa/notion-site/issues/45",
+			"> [nonacosa/notion-site#45](https://github.com/nonacosa/notion-site/issues/45)\n> Issue #45\n"},
+		// offline and never fetched: a card of the url
+		{FlavorCommonMark, "https://app.slack.com/archives/C123/p456",
+			"> [https://app.slack.com/archives/C123/p456](https://app.slack.com/archives/C123/p456)\n"},
+	}
+	for _, c := range cases {
+		tm.Flavor = c.flavor
+		block := &notion.LinkPreviewBlock{URL: c.url}
+		extra := map[string]any{}
+		if err := tm.injectLinkPreviewInfo(block, &extra); err != nil {
+			t.Fatal(err)
+		}
+		tm.ContentBuffer = new(bytes.Buffer)
+		if err := tm.GenBlock("link_preview", MdBlock{Block: block, Extra: extra}, false, true); err != nil {
+			t.Fatal(err)
+		}
+		if got := tm.ContentBuffer.String(); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.url, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// pageLanguage the language code of a page, from the select or text property
+// LanguageProp, else DefaultLanguage. Empty when languages are not configured.
+func pageLanguage(page notion.Page, config Notion) string {
+	if config.LanguageProp == "" {
+		return ""
+	}
+	var lang string
+	prop := getPropValue(page, config.LanguageProp)
+	switch {
+	case prop.Select != nil:
+		lang = prop.Select.Name
+	case len(prop.RichText) > 0:
+		lang = ConvertRichText(prop.RichText)
+	}
+	if lang = strings.TrimSpace(lang); lang == "" {
+		lang = config.DefaultLanguage
+	}
+	return strings.ToLower(lang)
+}
+
+// translationSource the page whose bundle the translations of page share.
+// Pages of one slug share it anyway; pages linked through TranslationProp
+// use the one in the default language, else the first by id. Only pages of
+// the same database query are known.
+func (ns *NotionSite) translationSource(page notion.Page, config Notion) notion.Page {
+	if config.TranslationProp == "" {
+		return page
+	}
+	group := []notion.Page{page}
+	for _, relation := range getPropValue(page, config.TranslationProp).Relation {
+		if p, ok := ns.databasePages[relation.ID]; ok {
+			group = append(group, p)
+		}
+	}
+	sort.Slice(group, func(i, j int) bool {
+		iDefault := pageLanguage(group[i], config) == strings.ToLower(config.DefaultLanguage)
+		jDefault := pageLanguage(group[j], config) == strings.ToLower(config.DefaultLanguage)
+		if iDefault != jDefault {
+			return iDefault
+		}
+		return group[i].ID < group[j].ID
+	})
+	return group[0]
+}
+
+// initLanguage sets the language of the current page and the bundle it goes to
+func (ns *NotionSite) initLanguage(page notion.Page) {
+	config := ns.currentSource.NotionConfig(ns.config.Notion)
+	np := ns.currentPageProp
+	if np.Language = pageLanguage(page, config); np.Language == "" || np.IsSettingFile {
+		np.Language = ""
+		return
+	}
+	source := ns.translationSource(page, config)
+	sourceProp := np
+	if source.ID != page.ID {
+		sourceProp = NewNotionProp(source)
+	}
+	np.TranslationCreateAt = sourceProp.CreateAt
+	np.TranslationKey = strings.TrimSpace(sourceProp.Slug)
+	if np.TranslationKey == "" {
+		np.TranslationKey = folderNameOf(sourceProp.Name)
+	}
+}
+
+// languageFileName name.md as name.<lang>.md
+func languageFileName(name, lang string) string {
+	if lang == "" {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + lang + ext
+}
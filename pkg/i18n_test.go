@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func translatedPage(id, name, slug, lang string, translations ...string) notion.Page {
+	props := notion.DatabasePageProperties{
+		nameProp: {Type: notion.DBPropTypeTitle, Title: richText(name)},
+	}
+	if slug != "" {
+		props[slugProp] = notion.DatabasePageProperty{Type: notion.DBPropTypeRichText, RichText: richText(slug)}
+	}
+	if lang != "" {
+		props["Language"] = notion.DatabasePageProperty{Type: notion.DBPropTypeSelect, Select: &notion.SelectOptions{Name: lang}}
+	}
+	var relations []notion.Relation
+	for _, t := range translations {
+		relations = append(relations, notion.Relation{ID: t})
+	}
+	props["Translations"] = notion.DatabasePageProperty{Type: notion.DBPropTypeRelation, Relation: relations}
+	return notion.Page{ID: id, Properties: props}
+}
+
+func TestLanguageBundles(t *testing.T) {
+	home := t.TempDir()
+	config := Config{
+		Notion:   Notion{LanguageProp: "Language", DefaultLanguage: "EN", TranslationProp: "Translations"},
+		Markdown: Markdown{HomePath: home},
+	}
+	ns := &NotionSite{config: config, files: NewFiles(config), tm: New()}
+	en := translatedPage("b", "Hello World", "", "", "a")
+	zh := translatedPage("a", "你好世界", "", "zh", "b")
+	fr := translatedPage("c", "Bonjour", "hello", "FR")
+	ns.databasePages = map[string]notion.Page{en.ID: en, zh.ID: zh, fr.ID: fr}
+
+	cases := []struct {
+		page notion.Page
+		lang string
+		path string
+	}{
+		// linked through the relation, the default language names the bundle
+		{en, "en", "content/post/hello-world/index.en.md"},
+		{zh, "zh", "content/post/hello-world/index.zh.md"},
+		// a shared slug
+		{fr, "fr", "content/post/hello/index.fr.md"},
+	}
+	for _, c := range cases {
+		initNotionSite(ns, c.page, nil)
+		if got := ns.currentPageProp.Language; got != c.lang {
+			t.Errorf("%s: got language %q, want %q", c.page.ID, got, c.lang)
+		}
+		if got, want := ns.files.FilePath, filepath.Join(home, c.path); got != want {
+			t.Errorf("%s: got %s, want %s", c.page.ID, got, want)
+		}
+	}
+	if key := ns.currentPageProp.TranslationKey; key != "hello" {
+		t.Errorf("got translation key %q", key)
+	}
+
+	// languages not configured
+	ns.config.LanguageProp = ""
+	initNotionSite(ns, zh, nil)
+	if got, want := ns.files.FilePath, filepath.Join(home, "content/post/你好世界/index.md"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestLanguageBundlesByMonth(t *testing.T) {
+	home := t.TempDir()
+	config := Config{
+		Notion:   Notion{LanguageProp: "Language", DefaultLanguage: "en", TranslationProp: "Translations"},
+		Markdown: Markdown{HomePath: home, GroupByMonth: true},
+	}
+	ns := &NotionSite{config: config, files: NewFiles(config), tm: New()}
+	en := translatedPage("b", "Hello World", "", "en", "a")
+	created := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	en.Properties.(notion.DatabasePageProperties)[createAtProp] = notion.DatabasePageProperty{Type: notion.DBPropTypeCreatedTime, CreatedTime: &created}
+	zh := translatedPage("a", "你好世界", "", "zh", "b")
+	translated := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	zh.Properties.(notion.DatabasePageProperties)[createAtProp] = notion.DatabasePageProperty{Type: notion.DBPropTypeCreatedTime, CreatedTime: &translated}
+	ns.databasePages = map[string]notion.Page{en.ID: en, zh.ID: zh}
+
+	// the translation is dated by its source page
+	for _, page := range []notion.Page{en, zh} {
+		initNotionSite(ns, page, nil)
+		if got, want := ns.files.FileFolderPath, filepath.Join(home, "content/post/2024-01-02/hello-world"); got != want {
+			t.Errorf("%s: got %s, want %s", page.ID, got, want)
+		}
+	}
+}
+
+func TestLanguageFileName(t *testing.T) {
+	cases := map[string]string{"index.md": "index.zh.md", "_index.md": "_index.zh.md", "comments.json": "comments.zh.json"}
+	for name, want := range cases {
+		if got := languageFileName(name, "zh"); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+	if got := languageFileName("index.md", ""); got != "index.md" {
+		t.Errorf("got %s", got)
+	}
+}
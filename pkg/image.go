@@ -0,0 +1,265 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	imageFormatJPEG     = "jpeg"
+	imageFormatPNG      = "png"
+	defaultImageQuality = 85
+)
+
+// ImageOptimizer resizes and re-encodes downloaded images. Re-encoding also
+// drops their metadata (EXIF, color profiles...), images kept as they are
+// lose their EXIF and text metadata.
+type ImageOptimizer struct {
+	MaxWidth int
+	// Format jpeg or png, empty keeps the original format
+	Format  string
+	Quality int
+
+	mu sync.Mutex
+	// images being or already optimized, the queue may hold the same
+	// download twice
+	running map[string]*sync.Mutex
+	done    map[string]mediaEntry
+}
+
+// NewImageOptimizer the optimizer of config. Images are written as jpeg or
+// png only: webp (and avif) sources are read, but there is no pure Go encoder
+// to write them, such formats are an error rather than silently ignored.
+func NewImageOptimizer(config Markdown) (*ImageOptimizer, error) {
+	opt := &ImageOptimizer{MaxWidth: config.ImageMaxWidth, Format: strings.ToLower(config.ImageFormat), Quality: config.ImageQuality}
+	switch opt.Format {
+	case "jpg":
+		opt.Format = imageFormatJPEG
+	case "", imageFormatJPEG, imageFormatPNG:
+	default:
+		return nil, fmt.Errorf("imageFormat %s is not supported, only jpeg and png can be written", opt.Format)
+	}
+	if opt.Quality <= 0 || opt.Quality > 100 {
+		opt.Quality = defaultImageQuality
+	}
+	return opt, nil
+}
+
+func (opt *ImageOptimizer) Enabled() bool {
+	return opt != nil && (opt.MaxWidth > 0 || opt.Format != "")
+}
+
+// variant tells apart the same image optimized with other settings
+func (opt *ImageOptimizer) variant() string {
+	return fmt.Sprintf("w%d-%s-q%d", opt.MaxWidth, opt.Format, opt.Quality)
+}
+
+// Optimize processes the image dir/name in place and returns its new entry.
+// Files that aren't images, animated gifs and svgs are kept as they are.
+func (opt *ImageOptimizer) Optimize(dir, name string) (mediaEntry, error) {
+	path := filepath.Join(dir, name)
+	opt.mu.Lock()
+	if opt.running == nil {
+		opt.running, opt.done = make(map[string]*sync.Mutex), make(map[string]mediaEntry)
+	}
+	lock, ok := opt.running[path]
+	if !ok {
+		lock = new(sync.Mutex)
+		opt.running[path] = lock
+	}
+	opt.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+	opt.mu.Lock()
+	entry, ok := opt.done[path]
+	opt.mu.Unlock()
+	if ok {
+		if _, err := os.Stat(entry.Path); err == nil {
+			return entry, nil
+		}
+	}
+	entry, err := opt.optimize(dir, name)
+	if err == nil {
+		opt.mu.Lock()
+		opt.done[path] = entry
+		opt.mu.Unlock()
+	}
+	return entry, err
+}
+
+func (opt *ImageOptimizer) optimize(dir, name string) (mediaEntry, error) {
+	entry := mediaEntry{Name: name, Path: filepath.Join(dir, name)}
+	data, err := os.ReadFile(entry.Path)
+	if err != nil {
+		return entry, err
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		// not an image we can decode
+		return entry, nil
+	}
+	entry.Width, entry.Height = cfg.Width, cfg.Height
+	if format == "gif" {
+		return entry, nil
+	}
+
+	target := opt.Format
+	if target == "" {
+		target = format
+	}
+	if target != imageFormatJPEG && target != imageFormatPNG {
+		// webp source without a target format, nothing to encode it to
+		target = imageFormatPNG
+	}
+	if opt.Format == "" && cfg.Width <= opt.MaxWidth {
+		return opt.replace(entry, stripMetadata(data, format), filepath.Ext(name), cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return entry, fmt.Errorf("decode %s: %w", name, err)
+	}
+	if opt.MaxWidth > 0 && cfg.Width > opt.MaxWidth {
+		height := cfg.Height * opt.MaxWidth / cfg.Width
+		dst := image.NewRGBA(image.Rect(0, 0, opt.MaxWidth, max(height, 1)))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
+		img = dst
+	}
+
+	var out bytes.Buffer
+	ext := ".png"
+	if target == imageFormatJPEG {
+		ext = ".jpg"
+		err = jpeg.Encode(&out, flatten(img), &jpeg.Options{Quality: opt.Quality})
+	} else {
+		err = png.Encode(&out, img)
+	}
+	if err != nil {
+		return entry, fmt.Errorf("encode %s: %w", name, err)
+	}
+	// keep the original when re-encoding doesn't pay off
+	if out.Len() >= len(data) && ext == strings.ToLower(filepath.Ext(name)) && img.Bounds().Dx() == cfg.Width {
+		return opt.replace(entry, stripMetadata(data, format), filepath.Ext(name), cfg.Width, cfg.Height)
+	}
+	return opt.replace(entry, out.Bytes(), ext, img.Bounds().Dx(), img.Bounds().Dy())
+}
+
+// replace the image of entry by data, named after its content like the
+// downloads. The file is written under a temporary name and renamed.
+func (opt *ImageOptimizer) replace(entry mediaEntry, data []byte, ext string, width, height int) (mediaEntry, error) {
+	prefix := strings.TrimSuffix(entry.Name, filepath.Ext(entry.Name))
+	if i := strings.LastIndex(prefix, "-"); i > 0 {
+		prefix = prefix[:i]
+	}
+	dir := filepath.Dir(entry.Path)
+	sum := sha256.Sum256(data)
+	replaced := mediaEntry{Name: contentName(prefix, sum[:], ext), Width: width, Height: height}
+	replaced.Path = filepath.Join(dir, replaced.Name)
+	if replaced.Path == entry.Path {
+		return replaced, nil
+	}
+	tmp, err := os.CreateTemp(dir, ".optimize-*")
+	if err != nil {
+		return entry, err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), replaced.Path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return entry, err
+	}
+	os.Remove(entry.Path)
+	return replaced, nil
+}
+
+// stripMetadata drops the EXIF, XMP, IPTC and comments of a jpeg and the
+// text, EXIF and time chunks of a png, without re-encoding the image. Color
+// profiles stay, they change how the image looks.
+func stripMetadata(data []byte, format string) []byte {
+	switch format {
+	case "jpeg":
+		return stripJPEG(data)
+	case "png":
+		return stripPNG(data)
+	}
+	return data
+}
+
+func stripJPEG(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data
+	}
+	out := append([]byte{}, data[:2]...)
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return data
+		}
+		marker := data[i+1]
+		// start of scan, the compressed image follows
+		if marker == 0xDA {
+			return append(out, data[i:]...)
+		}
+		size := int(data[i+2])<<8 | int(data[i+3])
+		if size < 2 || i+2+size > len(data) {
+			return data
+		}
+		// APP1 (EXIF, XMP), APP13 (IPTC), COM
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out = append(out, data[i:i+2+size]...)
+		}
+		i += 2 + size
+	}
+	return data
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func stripPNG(data []byte) []byte {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return data
+	}
+	out := append([]byte{}, pngSignature...)
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return data
+		}
+		size := int(data[i])<<24 | int(data[i+1])<<16 | int(data[i+2])<<8 | int(data[i+3])
+		end := i + 12 + size
+		if size < 0 || end > len(data) {
+			return data
+		}
+		switch string(data[i+4 : i+8]) {
+		case "tEXt", "zTXt", "iTXt", "eXIf", "tIME":
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out
+}
+
+// flatten paints transparent images on white, jpeg has no alpha
+func flatten(img image.Image) image.Image {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func writePNG(t *testing.T, path string, width, height int) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 200})
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImageOptimizer(t *testing.T) {
+	dir := t.TempDir()
+	writePNG(t, filepath.Join(dir, "shot-0123456789ab.png"), 400, 200)
+
+	opt, err := NewImageOptimizer(Markdown{ImageMaxWidth: 100, ImageFormat: "jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := opt.Optimize(dir, "shot-0123456789ab.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Width != 100 || entry.Height != 50 {
+		t.Errorf("got %dx%d, want 100x50", entry.Width, entry.Height)
+	}
+	if !strings.HasPrefix(entry.Name, "shot-") || filepath.Ext(entry.Name) != ".jpg" {
+		t.Errorf("unexpected name %s", entry.Name)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "shot-0123456789ab.png")); !os.IsNotExist(err) {
+		t.Error("the original should be replaced")
+	}
+
+	// small enough and no format: the original without its metadata
+	icon := filepath.Join(dir, "icon-0123456789ab.png")
+	writePNG(t, icon, 40, 30)
+	data, _ := os.ReadFile(icon)
+	text := []byte{0, 0, 0, 9, 't', 'E', 'X', 't', 'A', 'u', 't', 'h', 'o', 'r', 0, 'm', 'e', 1, 2, 3, 4}
+	os.WriteFile(icon, append(append(append([]byte{}, data[:33]...), text...), data[33:]...), 0644)
+	opt.Format = ""
+	if entry, err = opt.Optimize(dir, "icon-0123456789ab.png"); err != nil || !strings.HasPrefix(entry.Name, "icon-") || entry.Width != 40 {
+		t.Errorf("got %+v, %v", entry, err)
+	}
+	if stripped, _ := os.ReadFile(entry.Path); !bytes.Equal(stripped, data) {
+		t.Error("the text chunk should be dropped")
+	}
+	// the same download queued twice
+	if again, err := opt.Optimize(dir, "icon-0123456789ab.png"); err != nil || again != entry {
+		t.Errorf("got %+v, %v", again, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "doc.pdf"), []byte("%PDF-1.4"), 0644)
+	if entry, err := opt.Optimize(dir, "doc.pdf"); err != nil || entry.Name != "doc.pdf" || entry.Width != 0 {
+		t.Errorf("non images must be kept, got %+v, %v", entry, err)
+	}
+}
+
+func TestImageFormat(t *testing.T) {
+	if _, err := NewImageOptimizer(Markdown{ImageFormat: "webp"}); err == nil {
+		t.Error("webp can't be written and should be rejected")
+	}
+}
+
+func TestImageSize(t *testing.T) {
+	files := &Files{queue: newMediaQueue(), images: &ImageOptimizer{MaxWidth: 100}}
+	tm := New()
+	tm.NotionProps = &NotionProp{}
+	tm.Files = files
+	for _, c := range []struct {
+		entry mediaEntry
+		want  string
+	}{
+		{mediaEntry{Name: "cat.png", Width: 40, Height: 30}, `{{< figure src="media/cat.png" alt="" width="40" height="30" loading="lazy" >}}`},
+		// svg and other images without known dimensions
+		{mediaEntry{Name: "logo.svg"}, `{{< figure src="media/logo.svg" alt="" loading="lazy" >}}`},
+	} {
+		token := files.enqueueMedia("https://example.com/"+c.entry.Name, c.entry.Name, "")
+		image := &notion.ImageBlock{Type: notion.FileTypeExternal, External: &notion.FileExternal{URL: token}}
+		extra := map[string]any{}
+		if err := tm.injectImageInfo(image, "", &extra); err != nil {
+			t.Fatal(err)
+		}
+		tm.ContentBuffer = new(bytes.Buffer)
+		if err := tm.GenBlock("image", MdBlock{Block: image, Extra: extra}, false, true); err != nil {
+			t.Fatal(err)
+		}
+		files.queue.resolved = append(files.queue.resolved,
+			token, "media/"+c.entry.Name, strings.Replace(token, "@@media:", "@@media-size:", 1), sizeAttributes(c.entry))
+		if got := files.ResolveMedia(tm.ContentBuffer.String()); got != c.want+"\n" {
+			t.Errorf("got %q, want %q", got, c.want)
+		}
+	}
+}
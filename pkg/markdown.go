@@ -10,6 +10,7 @@ import (
 	"github.com/mitchellh/mapstructure"
 	"gopkg.in/yaml.v3"
 	"io"
+	"io/fs"
 	"log"
 	"reflect"
 	"strings"
@@ -49,14 +50,6 @@ type MdBlock struct {
 	Extra    map[string]any
 }
 
-type MediaBlock struct {
-	notion.ImageBlock
-	notion.VideoBlock
-	notion.PDFBlock
-	notion.AudioBlock
-	notion.FileBlock
-}
-
 type ToMarkdown struct {
 	NotionProps       *NotionProp
 	Files             *Files
@@ -66,7 +59,43 @@ type ToMarkdown struct {
 	ImgVisitPath      string
 	ArticleFolderPath string
 	ContentTemplate   string
-	extra             map[string]any
+	// Flavor selects templates/<flavor>/*.ntpl over the default hugo ones
+	Flavor string
+	// FrontMatterDefaults fill keys the page itself leaves empty
+	FrontMatterDefaults map[string]any
+	// ImageFigure renders images as figures with a visible caption,
+	// ImageLinkOriginal links them to their original url
+	ImageFigure       bool
+	ImageLinkOriginal bool
+	// FrontMatterFiles "first" keeps the first file of files properties, default all of them
+	FrontMatterFiles string
+	extra            map[string]any
+	// CoverKey and IconKey front matter keys of the page cover and icon
+	CoverKey string
+	IconKey  string
+	// Providers render embed, video and link_preview urls, default the built-in ones
+	Providers *ProviderRegistry
+	// TreeChildren links to the child pages of a page tree page, by id, of
+	// those written into its folder
+	TreeChildren map[string]string
+	// OGCard draws a social card for pages without a cover, nil to disable
+	OGCard *OGCard
+	// CommentsMode renders the Discussions of the page, see Markdown.Comments
+	CommentsMode string
+	Discussions  []Discussion
+	// commentBlocks the rendered blocks, whose comments are loaded after rendering
+	commentBlocks []string
+	// headings of the page so far and how often each anchor was used
+	headings []Heading
+	anchors  map[string]int
+	// SummaryBreak and SummaryLength place the more tag, see Markdown.SummaryBreak
+	SummaryBreak  string
+	SummaryLength int
+	hasMoreTag    bool
+	paragraphs    int
+	summary       string
+	// downloaded media, written even when FrontMatter has no such field
+	mediaFrontMatter map[string]any
 }
 
 type FrontMatter struct {
@@ -91,12 +120,28 @@ type FrontMatter struct {
 	Description     string   `json:"description"     yaml:"description,flow"`
 	MetaTitle       string   `json:"metaTitle"       yaml:"metaTitle,flow"`
 	MetaDescription string   `json:"metaDescription" yaml:"metaDescription,flow"`
+	Icon            string   `json:"icon,omitempty"  yaml:"icon,omitempty"`
 
 	// Support for custom URL and aliases from Notion properties
 	URL     string   `json:"url" yaml:"url,flow"`
 	Aliases []string `json:"aliases" yaml:"aliases,flow"`
-	// Calculate Chinese word count accurately. Default is true
-	//IsCJKLanguage bool   `json:"isCJKLanguage" yaml:"isCJKLanguage,flow"`
+	// TranslationKey links the translations of a page
+	TranslationKey string `json:"translationKey,omitempty" yaml:"translationKey,omitempty"`
+	// Language of the page in blogs.json, hugo reads it from the file name
+	Language string `json:"language,omitempty" yaml:"-"`
+	// MachineTranslated pages written by the Translator
+	MachineTranslated bool `json:"machineTranslated,omitempty" yaml:"machineTranslated,omitempty"`
+	// Source name of the page in blogs.json
+	Source string `json:"source,omitempty" yaml:"-"`
+	// Summary the text before the more tag, unless the page sets one
+	Summary string `json:"summary,omitempty" yaml:"summary,omitempty"`
+	// Headings tree of the page in blogs.json
+	Headings []*Heading `json:"headings,omitempty" yaml:"-"`
+	// Calculate Chinese word count accurately, set when most of the text is CJK
+	IsCJKLanguage bool `json:"isCJKLanguage" yaml:"isCJKLanguage"`
+	WordCount     int  `json:"wordCount"     yaml:"wordCount"`
+	// ReadingTime in minutes
+	ReadingTime int `json:"readingTime" yaml:"readingTime"`
 	//PublishDate   string `json:"publishDate"   yaml:"publishDate,flow"`
 }
 
@@ -109,12 +154,22 @@ func New() *ToMarkdown {
 }
 
 func (tm *ToMarkdown) WithFrontMatter(page notion.Page) {
+	tm.FrontMatter = make(map[string]any)
+	tm.mediaFrontMatter = make(map[string]any)
 	tm.injectFrontMatterCover(page.Cover)
-	pageProps := page.Properties.(notion.DatabasePageProperties)
-	for fmKey, property := range pageProps {
-		tm.injectFrontMatter(fmKey, property)
+	switch pageProps := page.Properties.(type) {
+	case notion.DatabasePageProperties:
+		for fmKey, property := range pageProps {
+			tm.injectFrontMatter(fmKey, property)
+		}
+	case notion.PageProperties:
+		tm.injectPageFrontMatter(page)
 	}
+	tm.injectFrontMatterIcon(page.Icon)
 	tm.FrontMatter["Title"] = tm.NotionProps.GetTitle()
+	if page.Cover == nil {
+		tm.injectOGCard(tm.NotionProps.GetTitle())
+	}
 }
 
 func (tm *ToMarkdown) EnableExtendedSyntax(target string) {
@@ -134,17 +189,64 @@ func (tm *ToMarkdown) shouldSkipRender(bType any) bool {
 }
 
 func (tm *ToMarkdown) GenerateTo(ns *NotionSite) (*FrontMatter, error) {
+	tm.headings, tm.anchors = nil, nil
+	tm.hasMoreTag, tm.paragraphs, tm.summary = false, 0, ""
+	tm.commentBlocks = nil
+	if err := tm.GenContentBlocks(ns.currentBlocks, 0); err != nil {
+		tm.ContentBuffer.Reset()
+		ns.files.DiscardMedia()
+		return nil, err
+	}
+	isPage := tm.NotionProps.IsSettingFile != true && tm.NotionProps.IsFolder() != true
+	// the comments of the blocks just rendered
+	if isPage {
+		ns.exportComments(ns.currentPage, tm.commentBlocks)
+	}
+	tm.resolveCommentRefs()
+	// statistics of the page itself, comments excluded
+	if isPage {
+		tm.injectStats()
+	}
+	if err := tm.genDiscussions(); err != nil {
+		tm.ContentBuffer.Reset()
+		ns.files.DiscardMedia()
+		return nil, err
+	}
+	tm.genTOC()
+	// the front matter comes after the content, it holds its summary
 	var fm *FrontMatter
-	if tm.NotionProps.IsSettingFile != true && tm.NotionProps.IsFolder() != true {
-		tmp, err := tm.GenFrontMatter(ns.files.currentWriter)
+	frontMatter := new(bytes.Buffer)
+	if isPage {
+		if tm.summary != "" {
+			setFrontMatterDefault(tm.FrontMatter, "Summary", tm.summary)
+		}
+		tmp, err := tm.GenFrontMatter(frontMatter)
 		if err != nil {
+			tm.ContentBuffer.Reset()
+			ns.files.DiscardMedia()
 			return nil, err
 		}
 		fm = tmp
 	}
-	if err := tm.GenContentBlocks(ns.currentBlocks, 0); err != nil {
+	if fm != nil {
+		fm.Headings = tm.headingTree()
+	}
+	// media were only registered while rendering, download them all at once
+	if err := ns.files.FlushMedia(); err != nil {
+		tm.ContentBuffer.Reset()
 		return fm, err
 	}
+	tm.ContentBuffer = bytes.NewBufferString(ns.files.ResolveMedia(tm.ContentBuffer.String()))
+	if fm != nil {
+		fm.Image = ns.files.ResolveMedia(fm.Image)
+		fm.Avatar = ns.files.ResolveMedia(fm.Avatar)
+		fm.Icon = ns.files.ResolveMedia(fm.Icon)
+	}
+	if frontMatter.Len() > 0 {
+		if _, err := io.WriteString(ns.files.currentWriter, ns.files.ResolveMedia(frontMatter.String())); err != nil {
+			return fm, err
+		}
+	}
 
 	if tm.ContentTemplate != "" {
 		t, err := template.ParseFiles(tm.ContentTemplate)
@@ -157,6 +259,8 @@ func (tm *ToMarkdown) GenerateTo(ns *NotionSite) (*FrontMatter, error) {
 		_, err := io.Copy(ns.files.currentWriter, tm.ContentBuffer)
 		return fm, err
 	}
+	// folder pages write no file, don't leak their content into the next page
+	tm.ContentBuffer.Reset()
 	return fm, nil
 }
 
@@ -165,31 +269,13 @@ func (tm *ToMarkdown) GenFrontMatter(writer io.Writer) (*FrontMatter, error) {
 	if len(tm.FrontMatter) == 0 {
 		return nil, nil
 	}
-	var imageKey string
-	var imagePath string
-	nfm := make(map[string]any)
-	for key, value := range tm.FrontMatter {
-		nfm[strings.ToLower(key)] = value
-		// find image FrontMatter
-		switch v := value.(type) {
-		case string:
-			if strings.HasPrefix(v, "image|") {
-				imageKey = key
-				imageOriginPath := v[len("image|"):]
-				imagePath = tm.downloadFrontMatterImage(imageOriginPath)
-				fmt.Println(imagePath)
-			}
-		default:
-
-		}
-
+	for key, value := range tm.FrontMatterDefaults {
+		setFrontMatterDefault(tm.FrontMatter, key, value)
 	}
 	if err := mapstructure.Decode(tm.FrontMatter, &fm); err != nil {
 	}
 	// hugo open translate https://gohugo.io/variables/page/
 	fm.IsTranslated = true
-	// chinese character statistics
-	//fm.IsCJKLanguage = true
 	
 	// 合并动态属性到 FrontMatter
 	dynamicFrontMatter := make(map[string]interface{})
@@ -212,6 +298,16 @@ func (tm *ToMarkdown) GenFrontMatter(writer io.Writer) (*FrontMatter, error) {
 		}
 	}
 	
+	// keys unknown to FrontMatter only survive through the map
+	for key, value := range tm.FrontMatterDefaults {
+		setFrontMatterDefault(dynamicFrontMatter, key, value)
+	}
+	for key, value := range tm.mediaFrontMatter {
+		if _, ok := dynamicFrontMatter[key]; !ok {
+			dynamicFrontMatter[key] = value
+		}
+	}
+
 	// 重新编码完整的 FrontMatter
 	frontMatters, err := yaml.Marshal(dynamicFrontMatter)
 
@@ -222,10 +318,6 @@ func (tm *ToMarkdown) GenFrontMatter(writer io.Writer) (*FrontMatter, error) {
 	buffer := new(bytes.Buffer)
 	buffer.WriteString("---\n")
 	buffer.Write(frontMatters)
-	// todo write dynamic key image FrontMatter
-	if len(imagePath) > 0 {
-		buffer.WriteString(fmt.Sprintf("%s: \"%s\"\n", strings.ToLower(imageKey), imagePath))
-	}
 	buffer.WriteString("---\n")
 	_, err = io.Copy(writer, buffer)
 	return fm, err
@@ -236,19 +328,21 @@ func (tm *ToMarkdown) GenContentBlocks(blocks []notion.Block, depth int) error {
 	var lastBlockType any
 	var currentBlockType string
 
-	hasMoreTag := false
 	for index, block := range blocks {
-		var addMoreTag = false
 		currentBlockType = GetBlockType(block)
 
 		if tm.shouldSkipRender(reflect.TypeOf(block)) {
 			continue
 		}
 
+		// each block its own extra, values injected for a block must not leak into the next
 		mdb := MdBlock{
 			Block: block,
 			Depth: depth,
-			Extra: tm.extra,
+			Extra: make(map[string]any, len(tm.extra)+1),
+		}
+		for key, value := range tm.extra {
+			mdb.Extra[key] = value
 		}
 
 		sameBlockIdx++
@@ -257,8 +351,8 @@ func (tm *ToMarkdown) GenContentBlocks(blocks []notion.Block, depth int) error {
 		}
 		mdb.Extra["SameBlockIdx"] = sameBlockIdx
 
-		var generate = func(more bool) error {
-			if err := tm.GenBlock(currentBlockType, mdb, addMoreTag, false); err != nil {
+		var generate = func() error {
+			if err := tm.GenBlock(currentBlockType, mdb, false, false); err != nil {
 				return err
 			}
 			lastBlockType = reflect.TypeOf(block)
@@ -268,28 +362,31 @@ func (tm *ToMarkdown) GenContentBlocks(blocks []notion.Block, depth int) error {
 
 		if tm.NotionProps.IsSettingFile == true {
 			if reflect.TypeOf(block) == reflect.TypeOf(&notion.CodeBlock{}) {
-				generate(false)
+				generate()
 				continue
 			}
 		}
 
+		// the summary only breaks between top level blocks
+		if depth == 0 && !tm.NotionProps.IsSettingFile && tm.summaryMarker(block) {
+			tm.genMoreTag()
+			continue
+		}
+
 		err := tm.inject(&mdb, blocks, index)
 
 		if err != nil {
 			return err
 		}
 
-		// todo configurable
-		if tm.ContentBuffer.Len() > 60 && !hasMoreTag && !tm.NotionProps.IsSettingFile {
-			addMoreTag = tm.ContentBuffer.Len() > 60
-			hasMoreTag = true
-		}
-
 		if tm.checkMermaid(block) {
 			currentBlockType = "mermaid"
 		}
 
-		generate(addMoreTag)
+		generate()
+		if depth == 0 && !tm.NotionProps.IsSettingFile {
+			tm.checkSummaryLength(block)
+		}
 	}
 	return nil
 }
@@ -312,13 +409,14 @@ func (tm *ToMarkdown) GenBlock(bType string, block MdBlock, addMoreTag bool, ski
 	funcs["deref"] = func(i *bool) bool { return *i }
 	funcs["rich2md"] = ConvertRichText
 	funcs["table2md"] = ConvertTable
+	funcs["escapeQuotes"] = escapeQuotes
 	funcs["log"] = func(p any) string {
 		s, _ := json.Marshal(p)
 		return string(s)
 	}
 
 	t := template.New(fmt.Sprintf("%s.ntpl", bType)).Funcs(funcs)
-	tpl, err := t.ParseFS(mdTemplatesFS, fmt.Sprintf("templates/%s.*", bType))
+	tpl, err := t.ParseFS(mdTemplatesFS, tm.templatePattern(bType))
 	if err != nil {
 		log.Printf("write ntpl error : %s \n", err)
 		return err
@@ -328,6 +426,7 @@ func (tm *ToMarkdown) GenBlock(bType string, block MdBlock, addMoreTag bool, ski
 	}
 
 	if !skip {
+		tm.genCommentRefs(block.ID())
 		if addMoreTag {
 			tm.ContentBuffer.WriteString("<!--more-->")
 		}
@@ -342,6 +441,74 @@ func (tm *ToMarkdown) GenBlock(bType string, block MdBlock, addMoreTag bool, ski
 	return nil
 }
 
+// templatePattern prefer the flavor template of the block type if there is one
+func (tm *ToMarkdown) templatePattern(bType string) string {
+	if tm.Flavor != "" && tm.Flavor != FlavorHugo {
+		pattern := fmt.Sprintf("templates/%s/%s.*", tm.Flavor, bType)
+		if matches, _ := fs.Glob(mdTemplatesFS, pattern); len(matches) > 0 {
+			return pattern
+		}
+	}
+	return fmt.Sprintf("templates/%s.*", bType)
+}
+
+// setFrontMatterDefault set value when the key (case-insensitive) is missing or empty
+func setFrontMatterDefault(fm map[string]any, key string, value any) {
+	for k, v := range fm {
+		if strings.EqualFold(k, key) {
+			if !isEmptyValue(v) {
+				return
+			}
+			key = k
+			break
+		}
+	}
+	fm[key] = value
+}
+
+func isEmptyValue(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+// downloadFrontMatterFile downloads a file of a files & media property,
+// uploaded or external, and returns its path
+func (tm *ToMarkdown) downloadFrontMatterFile(file notion.File) string {
+	// copies, DownloadMedia rewrites the url in place
+	media := &notion.FileBlock{Type: file.Type}
+	switch {
+	case file.Type == notion.FileTypeFile && file.File != nil:
+		media.File = &notion.FileFile{URL: file.File.URL}
+	case file.Type == notion.FileTypeExternal && file.External != nil:
+		media.External = &notion.FileExternal{URL: file.External.URL}
+	default:
+		return ""
+	}
+	if err := tm.Files.DownloadMedia(media); err != nil {
+		fmt.Printf("⚠ Downloading front matter file %s: %s\n", file.Name, err)
+		return ""
+	}
+	if media.Type == notion.FileTypeExternal {
+		return media.External.URL
+	}
+	return media.File.URL
+}
+
+// isStringFrontMatterField key (case-insensitive) is a string field of FrontMatter
+func isStringFrontMatterField(key string) bool {
+	field, ok := reflect.TypeOf(FrontMatter{}).FieldByNameFunc(func(name string) bool {
+		return strings.EqualFold(name, key)
+	})
+	return ok && field.Type.Kind() == reflect.String
+}
+
 func (tm *ToMarkdown) downloadFrontMatterImage(url string) string {
 
 	image := &notion.FileBlock{
@@ -352,6 +519,7 @@ func (tm *ToMarkdown) downloadFrontMatterImage(url string) string {
 		},
 	}
 	if err := tm.Files.DownloadMedia(image); err != nil {
+		fmt.Println("⚠ Downloading front matter image:", err)
 		return ""
 	}
 
@@ -0,0 +1,200 @@
+package pkg
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSetFrontMatterDefault(t *testing.T) {
+	fm := map[string]any{"Tags": []string{}, "Author": "nonacosa"}
+	setFrontMatterDefault(fm, "tags", []string{"docs"})
+	setFrontMatterDefault(fm, "author", "team")
+	setFrontMatterDefault(fm, "type", "docs")
+
+	if tags := fm["Tags"].([]string); len(tags) != 1 || tags[0] != "docs" {
+		t.Errorf("empty tags should take the default, got %v", fm["Tags"])
+	}
+	if fm["Author"] != "nonacosa" {
+		t.Errorf("page value should win, got %v", fm["Author"])
+	}
+	if fm["type"] != "docs" {
+		t.Errorf("missing key should be added, got %v", fm["type"])
+	}
+}
+
+func TestTemplatePattern(t *testing.T) {
+	tm := New()
+	if got := tm.templatePattern("callout"); got != "templates/callout.*" {
+		t.Errorf("hugo flavor: got %s", got)
+	}
+	tm.Flavor = FlavorCommonMark
+	if got := tm.templatePattern("callout"); got != "templates/commonmark/callout.*" {
+		t.Errorf("commonmark flavor: got %s", got)
+	}
+	if got := tm.templatePattern("paragraph"); got != "templates/paragraph.*" {
+		t.Errorf("commonmark fallback: got %s", got)
+	}
+}
+
+func TestChildPageLinks(t *testing.T) {
+	page := &notion.ChildPageBlock{Title: "Getting Started"}
+	tm := New()
+	tm.NotionProps = &NotionProp{}
+	cases := []struct {
+		children map[string]string
+		want     string
+	}{
+		// a child page of a database page, nested in a toggle, or failed, has no folder
+		{nil, "- Getting Started\n"},
+		{map[string]string{page.ID(): "start/"}, "- [Getting Started](start/)\n"},
+	}
+	for _, c := range cases {
+		tm.TreeChildren = c.children
+		extra := map[string]any{}
+		if err := tm.injectChildPageInfo(page, &extra); err != nil {
+			t.Fatal(err)
+		}
+		tm.ContentBuffer = new(bytes.Buffer)
+		if err := tm.GenBlock("child_page", MdBlock{Block: page, Extra: extra}, false, true); err != nil {
+			t.Fatal(err)
+		}
+		if got := tm.ContentBuffer.String(); got != c.want {
+			t.Errorf("got %q, want %q", got, c.want)
+		}
+	}
+}
+
+func TestImageTemplates(t *testing.T) {
+	image := &notion.ImageBlock{
+		Type:     notion.FileTypeExternal,
+		External: &notion.FileExternal{URL: "media/cat.png"},
+		Caption:  []notion.RichText{{Type: notion.RichTextTypeText, PlainText: `A "cat" | Our **cat**`, Text: &notion.Text{Content: `A "cat" | Our **cat**`}}},
+	}
+	tm := New()
+	tm.NotionProps = &NotionProp{}
+	tm.Files = &Files{}
+	tm.ImageFigure = true
+	extra := map[string]any{}
+	if err := tm.injectImageInfo(image, "https://example.com/cat.png", &extra); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		FlavorHugo:       `{{< figure src="media/cat.png" alt="A \"cat\"" caption="Our **cat**" loading="lazy" >}}` + "\n",
+		FlavorCommonMark: `<figure><img src="media/cat.png" alt="A &#34;cat&#34;" loading="lazy"><figcaption>Our cat</figcaption></figure>` + "\n",
+	}
+	for flavor, want := range cases {
+		tm.Flavor = flavor
+		tm.ContentBuffer = new(bytes.Buffer)
+		if err := tm.GenBlock("image", MdBlock{Block: image, Extra: extra}, false, true); err != nil {
+			t.Fatal(err)
+		}
+		if got := tm.ContentBuffer.String(); got != want {
+			t.Errorf("%s: got %q, want %q", flavor, got, want)
+		}
+	}
+}
+
+func TestImageLinkOriginal(t *testing.T) {
+	tm := New()
+	tm.NotionProps = &NotionProp{}
+	tm.Files = &Files{queue: newMediaQueue()}
+	tm.ImageLinkOriginal = true
+	cases := []struct {
+		image *notion.ImageBlock
+		want  string
+	}{
+		{&notion.ImageBlock{Type: notion.FileTypeExternal, External: &notion.FileExternal{URL: "https://example.com/cat.png"}},
+			"https://example.com/cat.png"},
+		// the signed url expires, the downloaded copy doesn't
+		{&notion.ImageBlock{Type: notion.FileTypeFile, File: &notion.FileFile{URL: "https://s3.amazonaws.com/ws/cat.png?X-Amz-Signature=1"}},
+			"@@media:2@@"},
+	}
+	for _, c := range cases {
+		mdb := &MdBlock{Block: c.image, Extra: map[string]any{}}
+		if err := tm.inject(mdb, []notion.Block{c.image}, 0); err != nil {
+			t.Fatal(err)
+		}
+		if got := mdb.Extra["Link"]; got != c.want {
+			t.Errorf("got %v, want %s", got, c.want)
+		}
+	}
+}
+
+func TestFilesFrontMatter(t *testing.T) {
+	var downloads []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads = append(downloads, r.URL.Path)
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+	files := []notion.File{
+		{Name: "cover.png", Type: notion.FileTypeExternal, External: &notion.FileExternal{URL: srv.URL + "/cover.png"}},
+		{Name: "b.png", Type: notion.FileTypeFile, File: &notion.FileFile{URL: srv.URL + "/ws/b.png?sig=1"}},
+		{Name: "c.png", Type: notion.FileTypeFile, File: &notion.FileFile{URL: srv.URL + "/ws/c.png?sig=1"}},
+	}
+	tm := New()
+	tm.NotionProps = &NotionProp{}
+	tm.Files = NewFiles(Config{Markdown: Markdown{HomePath: t.TempDir()}})
+	tm.FrontMatter = map[string]any{}
+	tm.mediaFrontMatter = map[string]any{}
+	tm.injectFrontMatter("Image", notion.DatabasePageProperty{Type: notion.DBPropTypeFiles, Files: files[1:]})
+	tm.injectFrontMatter("Gallery", notion.DatabasePageProperty{Type: notion.DBPropTypeFiles, Files: files[:2]})
+
+	buf := new(bytes.Buffer)
+	fm, err := tm.GenFrontMatter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tm.Files.FlushMedia(); err != nil {
+		t.Fatal(err)
+	}
+	// image only downloads its first file, c.png is never fetched
+	sort.Strings(downloads)
+	if strings.Join(downloads, " ") != "/cover.png /ws/b.png" {
+		t.Errorf("got downloads %v", downloads)
+	}
+	image := tm.Files.ResolveMedia(fm.Image)
+	if !regexp.MustCompile(`^media/b-\w{12}\.png$`).MatchString(image) {
+		t.Errorf("image should hold the first file, got %q", image)
+	}
+	gallery := tm.Files.ResolveMedia(buf.String())
+	if !regexp.MustCompile(`gallery:\n    - 'media/cover-\w{12}\.png'\n    - 'media/b-\w{12}\.png'\n`).MatchString(gallery) {
+		t.Errorf("unexpected front matter:\n%s", gallery)
+	}
+}
+
+func TestCoverAndIconKeys(t *testing.T) {
+	emoji := "🚀"
+	page := notion.Page{
+		Properties: notion.PageProperties{},
+		Icon:       &notion.Icon{Type: notion.IconTypeEmoji, Emoji: &emoji},
+	}
+	tm := New()
+	tm.NotionProps = &NotionProp{Title: "Launch"}
+	tm.Files = NewFiles(Config{Markdown: Markdown{HomePath: t.TempDir()}})
+	tm.Files.plan = NewPlan()
+	tm.IconKey = "emoji"
+	tm.CoverKey = "banner"
+	tm.OGCard, _ = NewOGCard("")
+	tm.WithFrontMatter(page)
+
+	buf := new(bytes.Buffer)
+	if _, err := tm.GenFrontMatter(buf); err != nil {
+		t.Fatal(err)
+	}
+	var fm map[string]any
+	if err := yaml.Unmarshal(bytes.Trim(buf.Bytes(), "-\n"), &fm); err != nil {
+		t.Fatal(err)
+	}
+	if banner, _ := fm["banner"].(string); fm["emoji"] != emoji || !strings.HasPrefix(banner, "media/og-card-") {
+		t.Errorf("unexpected front matter:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,145 @@
+package pkg
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/dstotijn/go-notion"
+)
+
+const (
+	mediaIndexName         = ".notion-media.json"
+	mediaStoreShared       = "shared"
+	defaultSharedMediaPath = "static/media"
+	mediaHashLength        = 12
+	mediaPrefixLength      = 32
+)
+
+// mediaIndex maps a media key to the content addressed file it was saved as,
+// so unchanged Notion files are never downloaded again although their signed
+// urls expire.
+type mediaIndex struct {
+	mu      sync.Mutex
+	path    string
+	Entries map[string]mediaEntry `json:"entries"`
+}
+
+type mediaEntry struct {
+	Name string `json:"name"`
+	// Path is where the file was last written, to copy it instead of downloading
+	Path string `json:"path"`
+	// Width and Height of images, when known
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Published the storage location the media was published to, see storageLocation
+	Published string `json:"published,omitempty"`
+}
+
+func loadMediaIndex(path string) *mediaIndex {
+	index := &mediaIndex{path: path, Entries: make(map[string]mediaEntry)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		fmt.Printf("⚠ Ignoring broken media index %s: %s\n", path, err)
+		index.Entries = make(map[string]mediaEntry)
+	}
+	return index
+}
+
+func (index *mediaIndex) get(key string) (mediaEntry, bool) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	entry, ok := index.Entries[key]
+	return entry, ok
+}
+
+func (index *mediaIndex) set(key string, entry mediaEntry) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.Entries[key] = entry
+}
+
+func (index *mediaIndex) save() error {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(index.path, data, 0644)
+}
+
+// mediaKey identifies a media: the block id + last_edited_time when it comes
+// from a block, else the url without its expiring signature. The rest of the
+// query stays, it can select another image, e.g. ?title= or resize params.
+func mediaKey(media any, rawURL string) string {
+	if block, ok := media.(notion.Block); ok && block.ID() != "" {
+		return block.ID() + "@" + block.LastEditedTime().Format(time.RFC3339Nano)
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		query := u.Query()
+		for key := range query {
+			if strings.HasPrefix(key, "X-Amz-") || signingParams[key] {
+				query.Del(key)
+			}
+		}
+		u.RawQuery = query.Encode()
+		u.Fragment = ""
+		return u.String()
+	}
+	return rawURL
+}
+
+// signingParams of Notion file urls, S3 ones all start with X-Amz-
+var signingParams = map[string]bool{"expirationTimestamp": true, "signature": true}
+
+// mediaPrefix human-readable part of a media file name and its extension
+func mediaPrefix(rawURL string) (prefix, ext string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("malformed url: %s", err)
+	}
+	splitPaths := strings.Split(u.Path, "/")
+	base := splitPaths[len(splitPaths)-1]
+	ext = strings.ToLower(filepath.Ext(base))
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	if base == "Untitled" && len(splitPaths) > 1 {
+		base = splitPaths[len(splitPaths)-2]
+	}
+	if unescaped, err := url.PathUnescape(base); err == nil {
+		base = unescaped
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(base) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+		case r == '-' || r == '_' || r == ' ' || r == '.':
+			b.WriteRune('-')
+		}
+	}
+	prefix = strings.Trim(b.String(), "-")
+	if len(prefix) > mediaPrefixLength {
+		prefix = strings.Trim(prefix[:mediaPrefixLength], "-")
+	}
+	if prefix == "" {
+		prefix = mediaRelativePath
+	}
+	return prefix, ext, nil
+}
+
+// contentName prefix-hash.ext, the same content always gets the same name
+func contentName(prefix string, sum []byte, ext string) string {
+	return fmt.Sprintf("%s-%s%s", prefix, hex.EncodeToString(sum)[:mediaHashLength], ext)
+}
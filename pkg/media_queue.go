@@ -0,0 +1,197 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultMediaConcurrency = 4
+
+// mediaAsset is a media registered while rendering. Templates only see its
+// tokens, FlushMedia downloads it and ResolveMedia swaps in the final path.
+type mediaAsset struct {
+	id      int
+	url     string
+	key     string
+	dir     string
+	link    string
+	blockID string
+	// fallback link of optional media that failed to download
+	fallback string
+	entry    mediaEntry
+	err      error
+}
+
+func (asset *mediaAsset) token() string {
+	return fmt.Sprintf("@@media:%d@@", asset.id)
+}
+
+func (asset *mediaAsset) nameToken() string {
+	return fmt.Sprintf("@@media-name:%d@@", asset.id)
+}
+
+func (asset *mediaAsset) sizeToken() string {
+	return fmt.Sprintf("@@media-size:%d@@", asset.id)
+}
+
+type mediaQueue struct {
+	mu       sync.Mutex
+	lastID   int
+	pending  []*mediaAsset
+	byKey    map[string]*mediaAsset
+	resolved []string
+}
+
+func newMediaQueue() *mediaQueue {
+	return &mediaQueue{byKey: make(map[string]*mediaAsset)}
+}
+
+// enqueueMedia registers a media to download into the current media folder
+// and returns the token standing for its path until it's resolved.
+func (files *Files) enqueueMedia(rawURL, key, blockID string) string {
+	return files.enqueue(&mediaAsset{url: rawURL, key: key, blockID: blockID})
+}
+
+// downloadOptional registers a media that falls back to rawURL instead of
+// failing the page when it can't be downloaded
+func (files *Files) downloadOptional(rawURL string) string {
+	if rawURL == "" {
+		return ""
+	}
+	return files.enqueue(&mediaAsset{url: rawURL, key: mediaKey(nil, rawURL), fallback: rawURL})
+}
+
+func (files *Files) enqueue(asset *mediaAsset) string {
+	asset.dir, asset.link = files.mediaDir()
+	q := files.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if queued, ok := q.byKey[asset.key+"|"+asset.dir]; ok {
+		return queued.token()
+	}
+	q.lastID++
+	asset.id = q.lastID
+	q.byKey[asset.key+"|"+asset.dir] = asset
+	q.pending = append(q.pending, asset)
+	return asset.token()
+}
+
+// FlushMedia downloads the registered media concurrently.
+func (files *Files) FlushMedia() error {
+	q := files.queue
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	workers := files.MediaConcurrency
+	if workers <= 0 {
+		workers = defaultMediaConcurrency
+	}
+	if workers > len(pending) {
+		workers = len(pending)
+	}
+	jobs := make(chan *mediaAsset)
+	var done int32
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for asset := range jobs {
+				asset.entry, asset.err = files.storeMedia(asset.url, asset.key, asset.dir)
+				fmt.Printf("⬇ Media [%d/%d] %s\n", atomic.AddInt32(&done, 1), len(pending), redactURL(asset.url))
+			}
+		}()
+	}
+	for _, asset := range pending {
+		jobs <- asset
+	}
+	close(jobs)
+	wg.Wait()
+
+	var errs []error
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, asset := range pending {
+		if asset.err != nil && asset.fallback != "" {
+			fmt.Printf("⚠ Linking %s: %s\n", redactURL(asset.url), asset.err)
+			delete(q.byKey, asset.key+"|"+asset.dir)
+			q.resolved = append(q.resolved, asset.token(), asset.fallback)
+			continue
+		}
+		if asset.err != nil {
+			errs = append(errs, fmt.Errorf("media of block %s: %w", asset.blockID, asset.err))
+			delete(q.byKey, asset.key+"|"+asset.dir)
+			continue
+		}
+		name, _ := RemoveSuffix(asset.entry.Name)
+		q.resolved = append(q.resolved,
+			asset.token(), joinLink(asset.link, asset.entry.Name),
+			asset.nameToken(), name,
+			asset.sizeToken(), sizeAttributes(asset.entry))
+	}
+	return errors.Join(errs...)
+}
+
+// DiscardMedia drops the media registered by a page that failed to render.
+func (files *Files) DiscardMedia() {
+	q := files.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, asset := range q.pending {
+		delete(q.byKey, asset.key+"|"+asset.dir)
+	}
+	q.pending = nil
+}
+
+// ResolveMedia replaces the tokens of downloaded media with their paths.
+func (files *Files) ResolveMedia(s string) string {
+	if !strings.Contains(s, "@@media") {
+		return s
+	}
+	q := files.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return strings.NewReplacer(q.resolved...).Replace(s)
+}
+
+// mediaSize token of the ` width="…" height="…"` attributes of a media
+// token, resolved to an empty string when the size isn't known
+func (files *Files) mediaSize(path string) string {
+	if !strings.HasPrefix(path, "@@media:") {
+		return ""
+	}
+	return strings.Replace(path, "@@media:", "@@media-size:", 1)
+}
+
+// joinLink like path.Join, without breaking the scheme of absolute links
+func joinLink(link, name string) string {
+	link = strings.TrimSuffix(strings.ReplaceAll(link, "\\", "/"), "/")
+	if link == "" {
+		return name
+	}
+	return link + "/" + name
+}
+
+func sizeAttributes(entry mediaEntry) string {
+	if entry.Width <= 0 || entry.Height <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(` width="%d" height="%d"`, entry.Width, entry.Height)
+}
+
+// mediaName file name without extension of a media path or token
+func (files *Files) mediaName(path string) string {
+	if strings.HasPrefix(path, "@@media:") {
+		return strings.Replace(path, "@@media:", "@@media-name:", 1)
+	}
+	name, _ := RemoveSuffix(path)
+	return name
+}
@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMediaQueue(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if strings.HasPrefix(r.URL.Path, "/missing") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	files := NewFiles(Config{Markdown: Markdown{HomePath: t.TempDir(), MediaConcurrency: 2}})
+	files.MediaPath = t.TempDir()
+	a := files.enqueueMedia(srv.URL+"/a.png", "a@1", "block-a")
+	b := files.enqueueMedia(srv.URL+"/b.png", "b@1", "block-b")
+	if again := files.enqueueMedia(srv.URL+"/a.png?sig=2", "a@1", "block-a"); again != a {
+		t.Errorf("same media should share a token, got %s and %s", a, again)
+	}
+	if err := files.FlushMedia(); err != nil {
+		t.Fatal(err)
+	}
+	if hits != 2 {
+		t.Errorf("got %d downloads, want 2", hits)
+	}
+	got := files.ResolveMedia("![a](" + a + ") ![b](" + b + ") " + files.mediaName(a))
+	if strings.Contains(got, "@@media") || !strings.Contains(got, "media/a-") || !strings.Contains(got, "media/b-") {
+		t.Errorf("unresolved content: %s", got)
+	}
+
+	missing := files.enqueueMedia(srv.URL+"/missing.png", "missing@1", "block-c")
+	err := files.FlushMedia()
+	if err == nil || !strings.Contains(err.Error(), "block-c") {
+		t.Errorf("failed media should name its block, got %v", err)
+	}
+	if got := files.ResolveMedia(missing); got != missing {
+		t.Errorf("failed media must not resolve, got %s", got)
+	}
+
+	optional := files.downloadOptional(srv.URL + "/missing-preview.png")
+	if err := files.FlushMedia(); err != nil {
+		t.Errorf("optional media must not fail the page, got %v", err)
+	}
+	if got := files.ResolveMedia(optional); got != srv.URL+"/missing-preview.png" {
+		t.Errorf("optional media should fall back to its url, got %s", got)
+	}
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestMediaPrefix(t *testing.T) {
+	cases := map[string]string{
+		"https://example.com/a/My%20Screenshot.PNG?X-Amz=1": "my-screenshot",
+		"https://s3.amazonaws.com/ws/4f1c/Untitled.png":     "4f1c",
+		"https://example.com/图片.jpg":                        "media",
+	}
+	for rawURL, want := range cases {
+		prefix, _, err := mediaPrefix(rawURL)
+		if err != nil || prefix != want {
+			t.Errorf("%s: got %q, %v, want %q", rawURL, prefix, err, want)
+		}
+	}
+}
+
+func TestMediaKey(t *testing.T) {
+	cases := map[string]string{
+		"https://s3.us-west-2.amazonaws.com/ws/a.png?X-Amz-Date=1&X-Amz-Signature=2#top":          "https://s3.us-west-2.amazonaws.com/ws/a.png",
+		"https://file.notion.so/f/f/ws/a.png?table=block&id=b1&expirationTimestamp=1&signature=2": "https://file.notion.so/f/f/ws/a.png?id=b1&table=block",
+		"https://site.example/og?title=A": "https://site.example/og?title=A",
+		"https://cdn.example/a.png?w=400": "https://cdn.example/a.png?w=400",
+	}
+	for rawURL, want := range cases {
+		if got := mediaKey(nil, rawURL); got != want {
+			t.Errorf("%s: got %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestStoreMediaDeduplicates(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("png bytes"))
+	}))
+	defer srv.Close()
+
+	home := t.TempDir()
+	files := NewFiles(Config{Markdown: Markdown{HomePath: home}})
+	first := filepath.Join(home, "a", "media")
+	second := filepath.Join(home, "b", "media")
+
+	entry, err := files.storeMedia(srv.URL+"/image.png?sig=1", "block@1", first)
+	name := entry.Name
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("png bytes"))
+	if want := contentName("image", sum[:], ".png"); name != want {
+		t.Errorf("got %s, want %s", name, want)
+	}
+	// expired signature, same block: served from the index
+	again, err := files.storeMedia(srv.URL+"/image.png?sig=2", "block@1", first)
+	if err != nil || again.Name != name {
+		t.Errorf("got %s, %v, want %s", again.Name, err, name)
+	}
+	// another bundle: copied from the first one
+	copied, err := files.storeMedia(srv.URL+"/image.png?sig=3", "block@1", second)
+	if err != nil || copied.Name != name {
+		t.Errorf("got %s, %v, want %s", copied.Name, err, name)
+	}
+	if hits != 1 {
+		t.Errorf("media should be downloaded once, got %d downloads", hits)
+	}
+
+	// switching the storage publishes the media already downloaded
+	storage := &recordingStorage{location: "s3:bucket"}
+	files.SetStorage(storage)
+	for _, dir := range []string{first, first, filepath.Join(home, "c", "media")} {
+		if _, err := files.storeMedia(srv.URL+"/image.png?sig=4", "block@1", dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(storage.published) != 2 {
+		t.Errorf("got %v, want the new location and the copy published", storage.published)
+	}
+}
+
+type recordingStorage struct {
+	location  string
+	published []string
+}
+
+func (s *recordingStorage) Publish(dir, name string) error {
+	s.published = append(s.published, filepath.Join(dir, name))
+	return nil
+}
+
+func (s *recordingStorage) Location() string {
+	return s.location
+}
+
+func TestMediaDirPublicLink(t *testing.T) {
+	home := "/site"
+	cases := []struct {
+		files    Files
+		dir      string
+		wantLink string
+	}{
+		{Files{HomePath: home, MediaPath: "/site/content/post/a/media", DefaultMediaFolderName: "media"}, "/site/content/post/a/media", "media"},
+		{Files{HomePath: home, MediaPath: "/site/content/post/a/media", ImagePublicLink: "https://cdn.example.com/"}, "/site/content/post/a/media", "https://cdn.example.com/post/a/media"},
+		{Files{HomePath: home, MediaStore: mediaStoreShared, SharedMediaPath: "static/media", ImagePublicLink: "https://cdn.example.com"}, "/site/static/media", "https://cdn.example.com/media"},
+		{Files{HomePath: home, MediaUploadPath: "upload", ImagePublicLink: "https://cdn.example.com/blog"}, "/site/upload", "https://cdn.example.com/blog"},
+	}
+	for _, c := range cases {
+		dir, link := c.files.mediaDir()
+		if filepath.ToSlash(dir) != c.dir || link != c.wantLink {
+			t.Errorf("got %s %s, want %s %s", dir, link, c.dir, c.wantLink)
+		}
+	}
+	if got := joinLink("https://cdn.example.com/blog", "a.png"); got != "https://cdn.example.com/blog/a.png" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/dstotijn/go-notion"
 	"log"
+	"net/http"
 	"os"
 	"reflect"
 	"time"
@@ -16,6 +17,9 @@ var spin = spinner.New(spinner.CharSets[14], time.Millisecond*100)
 
 type NotionAPI struct {
 	Client *notion.Client
+	// Offline renders from the response cache only, no network and no token needed
+	Offline bool
+	users   map[string]notion.User
 }
 
 func NewAPI() *NotionAPI {
@@ -24,6 +28,17 @@ func NewAPI() *NotionAPI {
 	}
 }
 
+// EnableCache keeps the API responses in dir, see cacheTransport.
+func (api *NotionAPI) EnableCache(dir string, offline bool) {
+	if dir == "" {
+		dir = defaultCacheDir
+	}
+	api.Offline = offline
+	api.Client = notion.NewClient(os.Getenv("NOTION_SECRET"), notion.WithHTTPClient(&http.Client{
+		Transport: newCacheTransport(dir, offline),
+	}))
+}
+
 func (api *NotionAPI) filterFromConfig(config Notion) *notion.DatabaseQueryFilter {
 	if config.FilterProp == "" || len(config.FilterValue) == 0 {
 		return nil
@@ -44,27 +59,47 @@ func (api *NotionAPI) filterFromConfig(config Notion) *notion.DatabaseQueryFilte
 	}
 }
 
-func (api *NotionAPI) FindBlockChildrenCommentLoop(client *notion.Client, blockArr []notion.Block, cursor string) (blocks []notion.Comment, err error) {
-	for i := 0; i < len(blockArr); i++ {
-		query := notion.FindCommentsByBlockIDQuery{
-			BlockID:     blockArr[i].ID(),
-			StartCursor: cursor,
-			PageSize:    100,
-		}
-		res, err := client.FindCommentsByBlockID(context.Background(), query)
-		if err != nil {
-			return nil, err
-		}
-		if len(res.Results) == 0 {
-			continue
-		}
-		blocks = append(blocks, res.Results...)
-		if !res.HasMore {
-			return blocks, nil
+// FindBlockChildrenCommentLoop comments of the blocks (or pages) blockIDs,
+// each one paginated with its own cursor
+func (api *NotionAPI) FindBlockChildrenCommentLoop(client *notion.Client, blockIDs []string) (comments []notion.Comment, err error) {
+	for _, id := range blockIDs {
+		var cursor string
+		for {
+			query := notion.FindCommentsByBlockIDQuery{
+				BlockID:     id,
+				StartCursor: cursor,
+				PageSize:    100,
+			}
+			res, err := client.FindCommentsByBlockID(context.Background(), query)
+			if err != nil {
+				return nil, fmt.Errorf("comments of %s: %w", id, err)
+			}
+			comments = append(comments, res.Results...)
+			if !res.HasMore || res.NextCursor == nil {
+				break
+			}
+			cursor = *res.NextCursor
 		}
-		cursor = *res.NextCursor
 	}
-	return blocks, nil
+	return comments, nil
+}
+
+// findUser the user by id, each user is fetched once. Without the user
+// information capability the user has no name.
+func (api *NotionAPI) findUser(client *notion.Client, id string) notion.User {
+	if user, ok := api.users[id]; ok {
+		return user
+	}
+	user, err := client.FindUserByID(context.Background(), id)
+	if err != nil {
+		fmt.Printf("⚠ User %s: %s\n", id, err)
+		user = notion.User{BaseUser: notion.BaseUser{ID: id}}
+	}
+	if api.users == nil {
+		api.users = make(map[string]notion.User)
+	}
+	api.users[id] = user
+	return user
 }
 
 func (api *NotionAPI) queryDatabase(client *notion.Client, config Notion, id string) (notion.DatabaseQueryResponse, error) {
@@ -108,20 +143,29 @@ func (api *NotionAPI) queryDatabase(client *notion.Client, config Notion, id str
 	return response, err
 }
 
-func (api *NotionAPI) queryBlockChildren(client *notion.Client, blockID string) (blocks []notion.Block, err error) {
+func (api *NotionAPI) findPage(client *notion.Client, pageID string) (notion.Page, error) {
+	spin.Suffix = " Fetching page..."
+	spin.Start()
+	defer spin.Stop()
+	return client.FindPageByID(context.Background(), pageID)
+}
+
+// queryBlockChildren fetch the blocks tree of a page, version is the page
+// last_edited_time and invalidates the cached tree.
+func (api *NotionAPI) queryBlockChildren(client *notion.Client, blockID string, version string) (blocks []notion.Block, err error) {
 	spin.Suffix = " Fetching blocks tree..."
 	spin.Start()
 	defer spin.Stop()
-	return api.retrieveBlockChildren(client, blockID)
+	return api.retrieveBlockChildren(withCacheVersion(context.Background(), version), client, blockID)
 }
 
-func (api *NotionAPI) retrieveBlockChildrenLoop(client *notion.Client, blockID, cursor string) (blocks []notion.Block, err error) {
+func (api *NotionAPI) retrieveBlockChildrenLoop(ctx context.Context, client *notion.Client, blockID, cursor string) (blocks []notion.Block, err error) {
 	for {
 		query := &notion.PaginationQuery{
 			StartCursor: cursor,
 			PageSize:    100,
 		}
-		res, err := client.FindBlockChildrenByID(context.Background(), blockID, query)
+		res, err := client.FindBlockChildrenByID(ctx, blockID, query)
 
 		if err != nil {
 			return nil, err
@@ -139,8 +183,8 @@ func (api *NotionAPI) retrieveBlockChildrenLoop(client *notion.Client, blockID,
 	}
 }
 
-func (api *NotionAPI) retrieveBlockChildren(client *notion.Client, blockID string) (blocks []notion.Block, err error) {
-	blocks, err = api.retrieveBlockChildrenLoop(client, blockID, "")
+func (api *NotionAPI) retrieveBlockChildren(ctx context.Context, client *notion.Client, blockID string) (blocks []notion.Block, err error) {
+	blocks, err = api.retrieveBlockChildrenLoop(ctx, client, blockID, "")
 	if err != nil {
 		return
 	}
@@ -152,19 +196,19 @@ func (api *NotionAPI) retrieveBlockChildren(client *notion.Client, blockID strin
 		}
 		switch blockType {
 		case reflect.TypeOf(&notion.ParagraphBlock{}):
-			block.(*notion.ParagraphBlock).Children, err = api.retrieveBlockChildren(client, block.ID())
+			block.(*notion.ParagraphBlock).Children, err = api.retrieveBlockChildren(ctx, client, block.ID())
 		case reflect.TypeOf(&notion.CalloutBlock{}):
-			block.(*notion.CalloutBlock).Children, err = api.retrieveBlockChildren(client, block.ID())
+			block.(*notion.CalloutBlock).Children, err = api.retrieveBlockChildren(ctx, client, block.ID())
 		case reflect.TypeOf(&notion.QuoteBlock{}):
-			block.(*notion.QuoteBlock).Children, err = api.retrieveBlockChildren(client, block.ID())
+			block.(*notion.QuoteBlock).Children, err = api.retrieveBlockChildren(ctx, client, block.ID())
 		case reflect.TypeOf(&notion.BulletedListItemBlock{}):
-			block.(*notion.BulletedListItemBlock).Children, err = api.retrieveBlockChildren(client, block.ID())
+			block.(*notion.BulletedListItemBlock).Children, err = api.retrieveBlockChildren(ctx, client, block.ID())
 		case reflect.TypeOf(&notion.NumberedListItemBlock{}):
-			block.(*notion.NumberedListItemBlock).Children, err = api.retrieveBlockChildren(client, block.ID())
+			block.(*notion.NumberedListItemBlock).Children, err = api.retrieveBlockChildren(ctx, client, block.ID())
 		case reflect.TypeOf(&notion.ToDoBlock{}):
-			block.(*notion.ToDoBlock).Children, err = api.retrieveBlockChildren(client, block.ID())
+			block.(*notion.ToDoBlock).Children, err = api.retrieveBlockChildren(ctx, client, block.ID())
 		case reflect.TypeOf(&notion.TableBlock{}):
-			block.(*notion.TableBlock).Children, err = api.retrieveBlockChildren(client, block.ID())
+			block.(*notion.TableBlock).Children, err = api.retrieveBlockChildren(ctx, client, block.ID())
 		case reflect.TypeOf(&notion.ColumnListBlock{}):
 			// todo should support column list block？
 		}
@@ -177,19 +221,26 @@ func (api *NotionAPI) retrieveBlockChildren(client *notion.Client, blockID strin
 	return blocks, nil
 }
 
-// changeStatus changes the Notion article status to the published value if set.
-// It returns true if status changed.
-func (api *NotionAPI) changeStatus(client *notion.Client, p notion.Page, config Notion) bool {
+// needChangeStatus reports whether the page status differs from the published
+// value, and returns the current status.
+func (api *NotionAPI) needChangeStatus(p notion.Page, config Notion) (string, bool) {
 	// No published value or filter prop to change
 	if config.FilterProp == "" || config.PublishedValue == "" {
-		return false
+		return "", false
 	}
 
-	if v, ok := p.Properties.(notion.DatabasePageProperties)[config.FilterProp]; ok {
-		if v.Select.Name == config.PublishedValue {
-			return false
-		}
-	} else { // No filter prop in page, can't change it
+	v, ok := p.Properties.(notion.DatabasePageProperties)[config.FilterProp]
+	// No filter prop in page, can't change it
+	if !ok || v.Select == nil {
+		return "", false
+	}
+	return v.Select.Name, v.Select.Name != config.PublishedValue
+}
+
+// changeStatus changes the Notion article status to the published value if set.
+// It returns true if status changed.
+func (api *NotionAPI) changeStatus(client *notion.Client, p notion.Page, config Notion) bool {
+	if _, ok := api.needChangeStatus(p, config); !ok || api.Offline {
 		return false
 	}
 
@@ -228,13 +279,14 @@ func (api *NotionAPI) mustParseDateTime(value string) notion.DateTime {
 	return dt
 }
 
-func (api *NotionAPI) CheckHasChildDataBase(blocks []notion.Block, cb func(bool, string)) bool {
+// CheckHasChildDataBase calls cb with the id of every child database block
+func (api *NotionAPI) CheckHasChildDataBase(blocks []notion.Block, cb func(string)) bool {
+	has := false
 	for _, block := range blocks {
 		if reflect.TypeOf(&notion.ChildDatabaseBlock{}) == reflect.TypeOf(block) {
-			cb(true, block.ID())
-			return true
+			cb(block.ID())
+			has = true
 		}
 	}
-	cb(false, "")
-	return false
+	return has
 }
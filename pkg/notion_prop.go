@@ -28,6 +28,7 @@ const (
 	showCommentsProp = "ShowComments"
 	slugProp         = "Slug"
 	typeProp         = "Type"
+	defaultPosition  = "content/post"
 	grayColor        = "rgba(120, 119, 116, 1)"
 	brownColor       = "rgba(159, 107, 83, 1)"
 	orangeColor      = "rgba(217, 115, 13, 1)"
@@ -90,6 +91,14 @@ type NotionProp struct {
 	IsSettingFile    bool
 	IsCustomNameFile bool
 	DynamicProps     map[string]interface{} `json:"dynamicProps,omitempty"`
+	// page tree: sections are written as _index.md, the root into the position folder itself
+	IsSection  bool
+	IsTreeRoot bool
+	// Language of the page, its translations share the TranslationKey bundle
+	Language       string
+	TranslationKey string
+	// TranslationCreateAt the creation date of the source page, which dates the bundle
+	TranslationCreateAt *time.Time
 }
 
 // 全局配置缓存（懒加载）
@@ -115,9 +124,15 @@ func NewNotionProp(page notion.Page) (np *NotionProp) {
 		Slug:         getRichText(page, slugProp),
 		Types:        getSelect(page, typeProp),
 	}
+	// standalone page: title and timestamps come from the page itself
+	if props, ok := page.Properties.(notion.PageProperties); ok {
+		np.Name = ConvertRichText(props.Title.Title)
+		np.CreateAt = &page.CreatedTime
+		np.LastMod = page.LastEditedTime
+	}
 	// default blog position from hugo home path
 	if np.Position == "" {
-		np.Position = "content/post"
+		np.Position = defaultPosition
 	}
 	np.IsSettingFile = np.IsSetting()
 	np.IsCustomNameFile = np.IsCustomNameMdFile()
@@ -129,7 +144,10 @@ func NewNotionProp(page notion.Page) (np *NotionProp) {
 }
 
 func getPropValue(page notion.Page, key string) notion.DatabasePageProperty {
-	properties := page.Properties.(notion.DatabasePageProperties)
+	properties, ok := page.Properties.(notion.DatabasePageProperties)
+	if !ok {
+		return notion.DatabasePageProperty{}
+	}
 	property := properties[key]
 	return property
 }
@@ -0,0 +1,147 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	ogCardWidth    = 1200
+	ogCardHeight   = 630
+	ogCardMargin   = 80
+	ogCardFontSize = 64
+	ogCardMaxLines = 5
+)
+
+var (
+	ogCardBackground = color.RGBA{R: 0x1f, G: 0x23, B: 0x28, A: 0xff}
+	ogCardForeground = color.White
+)
+
+// OGCard draws the social card of pages without a cover: the title on a
+// plain background. The bundled Go font has no CJK glyphs, set a font file
+// for such titles.
+type OGCard struct {
+	face font.Face
+}
+
+func NewOGCard(fontPath string) (*OGCard, error) {
+	data := gobold.TTF
+	if fontPath != "" {
+		var err error
+		if data, err = os.ReadFile(fontPath); err != nil {
+			return nil, err
+		}
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("og card font: %w", err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: ogCardFontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, fmt.Errorf("og card font: %w", err)
+	}
+	return &OGCard{face: face}, nil
+}
+
+// Render the card as png
+func (card *OGCard) Render(title string) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, ogCardWidth, ogCardHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(ogCardBackground), image.Point{}, draw.Src)
+
+	lines := card.wrap(title, ogCardWidth-2*ogCardMargin)
+	lineHeight := card.face.Metrics().Height.Ceil() * 5 / 4
+	// vertically centered
+	y := (ogCardHeight-lineHeight*len(lines))/2 + card.face.Metrics().Ascent.Ceil()
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(ogCardForeground), Face: card.face}
+	for _, line := range lines {
+		d.Dot = fixed.P(ogCardMargin, y)
+		d.DrawString(line)
+		y += lineHeight
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// wrap breaks the title into lines of at most width pixels, at spaces when
+// possible, anywhere for scripts written without them
+func (card *OGCard) wrap(title string, width int) []string {
+	limit := fixed.I(width)
+	var lines []string
+	var line []rune
+	for _, r := range strings.Join(strings.Fields(title), " ") {
+		line = append(line, r)
+		if font.MeasureString(card.face, string(line)) <= limit {
+			continue
+		}
+		cut := len(line) - 1
+		if i := lastSpace(line); i > 0 {
+			cut = i
+		}
+		if cut == 0 {
+			continue
+		}
+		lines = append(lines, strings.TrimSpace(string(line[:cut])))
+		line = []rune(strings.TrimLeft(string(line[cut:]), " "))
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+	if len(lines) > ogCardMaxLines {
+		lines = lines[:ogCardMaxLines]
+		last := []rune(lines[ogCardMaxLines-1])
+		lines[ogCardMaxLines-1] = string(last[:max(len(last)-1, 0)]) + "…"
+	}
+	return lines
+}
+
+func lastSpace(line []rune) int {
+	for i := len(line) - 1; i >= 0; i-- {
+		if line[i] == ' ' {
+			return i
+		}
+	}
+	return -1
+}
+
+// storeGenerated saves media made here rather than downloaded, like the
+// og cards, next to the downloaded ones and returns its link
+func (files *Files) storeGenerated(prefix, ext string, data []byte) (string, error) {
+	dir, link := files.mediaDir()
+	sum := sha256.Sum256(data)
+	name := contentName(prefix, sum[:], ext)
+	path := filepath.Join(dir, name)
+	if files.plan != nil {
+		files.plan.AddMedia("generated", path)
+		return joinLink(link, name), nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		if err := files.mkdirPath(dir); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return "", err
+		}
+	}
+	if err := files.storage.Publish(dir, name); err != nil {
+		return "", err
+	}
+	return joinLink(link, name), nil
+}
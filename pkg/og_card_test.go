@@ -0,0 +1,44 @@
+package pkg
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestOGCard(t *testing.T) {
+	card, err := NewOGCard("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := card.Render("Building a static site from Notion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != ogCardWidth || b.Dy() != ogCardHeight {
+		t.Errorf("got %v", b)
+	}
+
+	width := 400
+	lines := card.wrap("A rather long title that surely needs several lines", width)
+	if len(lines) < 2 {
+		t.Errorf("title should wrap, got %q", lines)
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, " ") || font.MeasureString(card.face, line) > fixed.I(width) {
+			t.Errorf("bad line %q", line)
+		}
+	}
+	// no spaces to break at
+	if lines := card.wrap(strings.Repeat("x", 100), width); len(lines) < 2 {
+		t.Errorf("got %q", lines)
+	}
+}
@@ -0,0 +1,251 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	planCreate = "create"
+	planChange = "change"
+	planKeep   = "keep"
+	planStale  = "stale"
+)
+
+// Plan collects everything a dry run would do instead of touching disk or Notion.
+type Plan struct {
+	mu            sync.Mutex
+	Files         []PlannedFile
+	Media         []PlannedMedia
+	StatusChanges []PlannedStatus
+	Failures      []string
+
+	// what the run produces, files left over in positions are stale
+	produced   map[string]bool
+	mediaGlobs []string
+	keptDirs   []string
+	positions  map[string]bool
+}
+
+type PlannedFile struct {
+	Path    string
+	Action  string
+	Added   int
+	Removed int
+	// Source the language of a machine translation, its lines are only known
+	// once translated
+	Source string
+}
+
+type PlannedMedia struct {
+	URL  string
+	Path string
+}
+
+type PlannedStatus struct {
+	PageID string
+	Title  string
+	From   string
+	To     string
+}
+
+func NewPlan() *Plan {
+	return &Plan{produced: make(map[string]bool), positions: make(map[string]bool)}
+}
+
+// AddFile compares the rendered content with what is currently on disk.
+func (p *Plan) AddFile(path string, content []byte) {
+	pf := PlannedFile{Path: path}
+	old, err := os.ReadFile(path)
+	switch {
+	case err != nil:
+		pf.Action = planCreate
+		pf.Added = countLines(content)
+	case bytes.Equal(old, content):
+		pf.Action = planKeep
+	default:
+		pf.Action = planChange
+		pf.Added, pf.Removed = diffStat(old, content)
+	}
+	p.Files = append(p.Files, pf)
+	p.UseFile(path)
+}
+
+// AddTranslation a machine translation the run would write to path
+func (p *Plan) AddTranslation(path, source string) {
+	pf := PlannedFile{Path: path, Action: planCreate, Source: source}
+	if _, err := os.Stat(path); err == nil {
+		pf.Action = planChange
+	}
+	p.Files = append(p.Files, pf)
+	p.UseFile(path)
+}
+
+// AddMedia is called by the concurrent media downloads
+func (p *Plan) AddMedia(url, path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Media = append(p.Media, PlannedMedia{URL: url, Path: path})
+	if strings.Contains(path, "<hash>") {
+		p.mediaGlobs = append(p.mediaGlobs, strings.Replace(path, "<hash>", "*", 1))
+	} else {
+		p.produced[path] = true
+	}
+}
+
+// UseFile marks an existing file the run keeps, e.g. media already downloaded
+func (p *Plan) UseFile(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.produced[path] = true
+}
+
+// KeepDir leaves the files under dir alone, e.g. of a page that failed to render
+func (p *Plan) KeepDir(dir string) {
+	p.keptDirs = append(p.keptDirs, dir)
+}
+
+// AddPosition a folder pages are rendered into, checked by AddStale
+func (p *Plan) AddPosition(dir string) {
+	p.positions[dir] = true
+}
+
+// AddStale reports the markdown, comments and media files in the positions
+// the run no longer produces, e.g. of renamed or unpublished pages, or written
+// by hand. Runs never remove them, they are only listed.
+func (p *Plan) AddStale() {
+	var stale []string
+	seen := make(map[string]bool)
+	for dir := range p.positions {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || seen[path] || !p.generated(path) {
+				return nil
+			}
+			seen[path] = true
+			if !p.isProduced(path) {
+				stale = append(stale, path)
+			}
+			return nil
+		})
+	}
+	sort.Strings(stale)
+	for _, path := range stale {
+		p.Files = append(p.Files, PlannedFile{Path: path, Action: planStale})
+	}
+}
+
+// generated files of the kinds a run writes into a position
+func (p *Plan) generated(path string) bool {
+	name := filepath.Base(path)
+	return filepath.Ext(name) == ".md" ||
+		strings.HasPrefix(name, "comments.") && filepath.Ext(name) == ".json" ||
+		filepath.Base(filepath.Dir(path)) == mediaRelativePath
+}
+
+func (p *Plan) isProduced(path string) bool {
+	if p.produced[path] {
+		return true
+	}
+	for _, glob := range p.mediaGlobs {
+		if ok, _ := filepath.Match(glob, path); ok {
+			return true
+		}
+	}
+	for _, dir := range p.keptDirs {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Plan) AddStatusChange(pageID, title, from, to string) {
+	p.StatusChanges = append(p.StatusChanges, PlannedStatus{PageID: pageID, Title: title, From: from, To: to})
+}
+
+func (p *Plan) AddFailure(format string, a ...any) {
+	p.Failures = append(p.Failures, fmt.Sprintf(format, a...))
+}
+
+// Failed reports whether anything in the run would have failed.
+func (p *Plan) Failed() bool {
+	return len(p.Failures) > 0
+}
+
+func (p *Plan) Print(w io.Writer) {
+	var created, changed, kept, stale int
+	fmt.Fprintln(w, "📋 Dry run plan")
+	for _, f := range p.Files {
+		switch f.Action {
+		case planCreate:
+			created++
+			if f.Source != "" {
+				fmt.Fprintf(w, "  + %s (new, translated from %s)\n", f.Path, f.Source)
+			} else {
+				fmt.Fprintf(w, "  + %s (new, %d lines)\n", f.Path, f.Added)
+			}
+		case planChange:
+			changed++
+			if f.Source != "" {
+				fmt.Fprintf(w, "  ~ %s (translated again from %s)\n", f.Path, f.Source)
+			} else {
+				fmt.Fprintf(w, "  ~ %s (+%d -%d)\n", f.Path, f.Added, f.Removed)
+			}
+		case planKeep:
+			kept++
+			fmt.Fprintf(w, "  = %s (unchanged)\n", f.Path)
+		case planStale:
+			stale++
+			fmt.Fprintf(w, "  ! %s (stale, not removed)\n", f.Path)
+		}
+	}
+	for _, m := range p.Media {
+		fmt.Fprintf(w, "  ⬇ %s -> %s\n", m.URL, m.Path)
+	}
+	for _, s := range p.StatusChanges {
+		fmt.Fprintf(w, "  ✎ %s [%s] %s -> %s\n", s.Title, s.PageID, s.From, s.To)
+	}
+	for _, f := range p.Failures {
+		fmt.Fprintf(w, "  ❌ %s\n", f)
+	}
+	fmt.Fprintf(w, "%d created, %d changed, %d unchanged, %d stale, %d media, %d status changes, %d failures\n",
+		created, changed, kept, stale, len(p.Media), len(p.StatusChanges), len(p.Failures))
+}
+
+func countLines(b []byte) int {
+	if len(b) == 0 {
+		return 0
+	}
+	return len(strings.Split(strings.TrimSuffix(string(b), "\n"), "\n"))
+}
+
+// diffStat returns a line based summary (added, removed) between two contents.
+// Lines are compared as multisets, which is enough for a plan summary.
+func diffStat(old, new []byte) (added, removed int) {
+	counts := make(map[string]int)
+	if len(old) > 0 {
+		for _, l := range strings.Split(strings.TrimSuffix(string(old), "\n"), "\n") {
+			counts[l]++
+		}
+	}
+	if len(new) > 0 {
+		for _, l := range strings.Split(strings.TrimSuffix(string(new), "\n"), "\n") {
+			counts[l]--
+		}
+	}
+	for _, n := range counts {
+		if n > 0 {
+			removed += n
+		} else {
+			added -= n
+		}
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffStat(t *testing.T) {
+	added, removed := diffStat([]byte("a\nb\nc\n"), []byte("a\nc\nd\ne\n"))
+	if added != 2 || removed != 1 {
+		t.Fatalf("got +%d -%d, want +2 -1", added, removed)
+	}
+}
+
+func TestPlanAddFile(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "index.md")
+	if err := os.WriteFile(existing, []byte("title\nbody\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPlan()
+	p.AddFile(filepath.Join(dir, "new.md"), []byte("one\ntwo\n"))
+	p.AddFile(existing, []byte("title\nbody\n"))
+	p.AddFile(existing, []byte("title\nnew body\n"))
+
+	want := []string{planCreate, planKeep, planChange}
+	for i, f := range p.Files {
+		if f.Action != want[i] {
+			t.Errorf("file %d: got %s, want %s", i, f.Action, want[i])
+		}
+	}
+	if p.Files[0].Added != 2 {
+		t.Errorf("new file lines: got %d, want 2", p.Files[0].Added)
+	}
+	if p.Failed() {
+		t.Error("plan without failures reported as failed")
+	}
+}
+
+func TestPlanAddStale(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"kept/index.md", "kept/media/a-1.png", "renamed/index.md", "renamed/media/b-2.png",
+		"renamed/comments.json", "failed/index.md", "hand-made/notes.txt", "new/media/c-3.png"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("line\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewPlan()
+	p.AddPosition(dir)
+	p.AddFile(filepath.Join(dir, "kept/index.md"), []byte("line\n"))
+	p.UseFile(filepath.Join(dir, "kept/media/a-1.png"))
+	p.AddMedia("https://example.com/c.png", filepath.Join(dir, "new/media/c-<hash>.png"))
+	p.KeepDir(filepath.Join(dir, "failed"))
+	p.AddStale()
+
+	var stale []string
+	for _, f := range p.Files {
+		if f.Action == planStale {
+			rel, _ := filepath.Rel(dir, f.Path)
+			stale = append(stale, filepath.ToSlash(rel))
+		}
+	}
+	want := []string{"renamed/comments.json", "renamed/index.md", "renamed/media/b-2.png"}
+	if strings.Join(stale, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", stale, want)
+	}
+}
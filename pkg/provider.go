@@ -0,0 +1,369 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Provider recognises the urls of a site and renders them, for embed, video
+// and link_preview blocks. Providers can be added or overridden by name in
+// the providers section of the config.
+type Provider struct {
+	Name string `yaml:"name"`
+	// Hosts the provider handles, subdomains included
+	Hosts []string `yaml:"hosts"`
+	// Pattern is matched against the url path and query. Its named groups are
+	// .Params, the first group named id... (else the first group) is .Id
+	Pattern string `yaml:"pattern"`
+	// Embed template of the player url, optional
+	Embed string `yaml:"embed,omitempty"`
+	// Template renders the hugo output, default an iframe shortcode of Embed.
+	// CommonMark renders the commonmark output, default an iframe of Embed.
+	Template   string `yaml:"template,omitempty"`
+	CommonMark string `yaml:"commonmark,omitempty"`
+	// Width and Height of the iframe (default 100% and 450), Ratio its aspect
+	// ratio like 16:9, Sandbox its sandbox attribute
+	Width   string `yaml:"width,omitempty"`
+	Height  string `yaml:"height,omitempty"`
+	Ratio   string `yaml:"ratio,omitempty"`
+	Sandbox string `yaml:"sandbox,omitempty"`
+
+	pattern    *regexp.Regexp
+	embed      *template.Template
+	template   *template.Template
+	commonMark *template.Template
+}
+
+// ProviderMatch is a url recognised by a provider, the data of its templates
+type ProviderMatch struct {
+	Provider *Provider
+	Url      string
+	Id       string
+	Params   map[string]string
+	EmbedUrl string
+	Width    string
+	Height   string
+	Ratio    string
+	// AspectRatio the Ratio as css, 16 / 9
+	AspectRatio string
+	Sandbox     string
+}
+
+const (
+	// positional, hugo can't mix them with named params and themes read the url as .Get 0
+	defaultProviderTemplate = `{{"{{< iframe"}} "{{ .EmbedUrl }}" "{{ .Width }}" "{{ .Height }}"` +
+		`{{ if or .Ratio .Sandbox }} "{{ .Ratio }}" "{{ .Sandbox }}"{{ end }}{{" >}}"}}`
+	defaultProviderCommonMark = `<iframe src="{{ .EmbedUrl }}" width="{{ .Width }}" height="{{ .Height }}"` +
+		`{{ with .AspectRatio }} style="aspect-ratio: {{ . }}; height: auto"{{ end }}{{ with .Sandbox }} sandbox="{{ . }}"{{ end }}` +
+		` frameborder="0" allowfullscreen></iframe>`
+	defaultEmbedWidth  = "100%"
+	defaultEmbedHeight = "450"
+)
+
+// iframeProvider renders the embeds no provider recognises, sandboxed. A
+// provider named iframe in the config replaces it, hosts and pattern unused.
+var iframeProvider = Provider{
+	Name:    "iframe",
+	Embed:   "{{ .Url }}",
+	Sandbox: "allow-scripts allow-same-origin allow-popups allow-forms allow-presentation",
+}
+
+// builtinProviders in matching order
+var builtinProviders = []Provider{
+	{
+		Name:     "youtube",
+		Hosts:    []string{"youtube.com", "youtube-nocookie.com"},
+		Pattern:  `[?&]v=(?P<id>[\w-]{11})|/(?:shorts|embed|live|v)/(?P<id2>[\w-]{11})`,
+		Embed:    "https://www.youtube-nocookie.com/embed/{{ .Id }}",
+		Template: `{{"{{< youtube id=\""}}{{ .Id }}{{"\" >}}"}}`,
+		Ratio:    "16:9",
+	},
+	{
+		Name:     "youtube",
+		Hosts:    []string{"youtu.be"},
+		Pattern:  `^/(?P<id>[\w-]{11})`,
+		Embed:    "https://www.youtube-nocookie.com/embed/{{ .Id }}",
+		Template: `{{"{{< youtube id=\""}}{{ .Id }}{{"\" >}}"}}`,
+		Ratio:    "16:9",
+	},
+	{
+		Name:     "vimeo",
+		Hosts:    []string{"vimeo.com"},
+		Pattern:  `^/(?:video/|channels/[\w-]+/|groups/[\w-]+/videos/)?(?P<id>\d+)`,
+		Embed:    "https://player.vimeo.com/video/{{ .Id }}",
+		Template: `{{"{{< vimeo id=\""}}{{ .Id }}{{"\" >}}"}}`,
+		Ratio:    "16:9",
+	},
+	{
+		Name:     "bilibili",
+		Hosts:    []string{"bilibili.com", "b23.tv"},
+		Pattern:  `/video/(?P<id>BV\w{10}|av\d+)|[?&]bvid=(?P<id2>BV\w{10})|^/(?P<id3>BV\w{10})`,
+		Embed:    `https://player.bilibili.com/player.html?{{ if eq (slice .Id 0 2) "av" }}aid={{ slice .Id 2 }}{{ else }}bvid={{ .Id }}{{ end }}`,
+		Template: `{{"{{< bilibili "}}{{ .Id }}{{" >}}"}}`,
+		Ratio:    "16:9",
+	},
+	{
+		Name:    "loom",
+		Hosts:   []string{"loom.com"},
+		Pattern: `^/(?:share|embed)/(?P<id>[0-9a-f]{32})`,
+		Embed:   "https://www.loom.com/embed/{{ .Id }}",
+		Ratio:   "16:9",
+	},
+	{
+		Name:     "twitter",
+		Hosts:    []string{"twitter.com", "x.com"},
+		Pattern:  `^/(?P<user>\w+)/status(?:es)?/(?P<id>\d+)`,
+		Template: `{{"{{< x user=\""}}{{ .Params.user }}{{"\" id=\""}}{{ .Id }}{{"\" >}}"}}`,
+	},
+	{
+		Name:     "gist",
+		Hosts:    []string{"gist.github.com"},
+		Pattern:  `^/(?P<user>[\w-]+)/(?P<id>[0-9a-f]+)`,
+		Template: `{{"{{< gist "}}{{ .Params.user }} {{ .Id }}{{" >}}"}}`,
+	},
+	{
+		Name:     "jsfiddle",
+		Hosts:    []string{"jsfiddle.net"},
+		Pattern:  `^/(?P<id>[\w-]+(?:/[\w-]+)?)`,
+		Embed:    "https://jsfiddle.net/{{ .Id }}/embedded/",
+		Template: `{{"{{< jsfiddle url=\""}}{{ .Id }}{{"\" >}}"}}`,
+	},
+	{
+		Name:    "codepen",
+		Hosts:   []string{"codepen.io"},
+		Pattern: `^/(?P<user>[\w-]+)/(?:pen|embed|details|full)/(?P<id>\w+)`,
+		Embed:   "https://codepen.io/{{ .Params.user }}/embed/{{ .Id }}?default-tab=result",
+	},
+	{
+		Name:    "figma",
+		Hosts:   []string{"figma.com"},
+		Pattern: `^/(?:file|design|proto|board|slides|deck)/(?P<id>\w+)`,
+		Embed:   "https://www.figma.com/embed?embed_host=share&url={{ urlquery .Url }}",
+		Height:  "600",
+	},
+	{
+		Name:    "google-docs",
+		Hosts:   []string{"docs.google.com"},
+		Pattern: `^/document/d/(?P<pub>e/)?(?P<id>[\w-]+)`,
+		Embed:   "https://docs.google.com/document/d/{{ if .Params.pub }}e/{{ .Id }}/pub?embedded=true{{ else }}{{ .Id }}/preview{{ end }}",
+		Height:  "800",
+	},
+	{
+		Name:    "google-sheets",
+		Hosts:   []string{"docs.google.com"},
+		Pattern: `^/spreadsheets/d/(?P<pub>e/)?(?P<id>[\w-]+)`,
+		Embed:   "https://docs.google.com/spreadsheets/d/{{ if .Params.pub }}e/{{ .Id }}/pubhtml?widget=true&headers=false{{ else }}{{ .Id }}/preview{{ end }}",
+		Height:  "600",
+	},
+	{
+		Name:    "google-slides",
+		Hosts:   []string{"docs.google.com"},
+		Pattern: `^/presentation/d/(?P<pub>e/)?(?P<id>[\w-]+)`,
+		Embed:   "https://docs.google.com/presentation/d/{{ if .Params.pub }}e/{{ end }}{{ .Id }}/embed",
+		Ratio:   "16:9",
+	},
+	{
+		Name:    "google-drive",
+		Hosts:   []string{"drive.google.com"},
+		Pattern: `^/drive/(?:u/\d+/)?folders/(?P<id>[\w-]+)`,
+		Embed:   "https://drive.google.com/embeddedfolderview?id={{ .Id }}#list",
+	},
+	{
+		Name:    "google-drive",
+		Hosts:   []string{"drive.google.com"},
+		Pattern: `^/file/d/(?P<id>[\w-]+)|[?&]id=(?P<id2>[\w-]+)`,
+		Embed:   "https://drive.google.com/file/d/{{ .Id }}/preview",
+		Ratio:   "4:3",
+	},
+	{
+		Name:    "google-maps",
+		Hosts:   []string{"google.com", "maps.google.com"},
+		Pattern: `^/maps/(?:place|search)/(?P<id>[^/?]+)`,
+		Embed:   "https://maps.google.com/maps?q={{ .Id }}&output=embed",
+	},
+	{
+		Name:    "spotify",
+		Hosts:   []string{"open.spotify.com"},
+		Pattern: `^/(?:embed/)?(?P<kind>track|album|playlist|episode|show|artist)/(?P<id>\w+)`,
+		Embed:   "https://open.spotify.com/embed/{{ .Params.kind }}/{{ .Id }}",
+	},
+}
+
+// ProviderRegistry the providers urls are matched against, in order
+type ProviderRegistry struct {
+	providers []*Provider
+	fallback  *Provider
+}
+
+// NewProviderRegistry custom providers first, then the built-in ones they
+// don't replace by name
+func NewProviderRegistry(custom []Provider) (*ProviderRegistry, error) {
+	fallback := iframeProvider
+	registry := &ProviderRegistry{fallback: &fallback}
+	replaced := make(map[string]bool)
+	var providers []Provider
+	for _, p := range custom {
+		if p.Name == iframeProvider.Name {
+			if p.Embed == "" {
+				p.Embed = iframeProvider.Embed
+			}
+			fallback = p
+			continue
+		}
+		replaced[p.Name] = true
+		providers = append(providers, p)
+	}
+	if err := fallback.compile(); err != nil {
+		return nil, err
+	}
+	for _, p := range builtinProviders {
+		if !replaced[p.Name] {
+			providers = append(providers, p)
+		}
+	}
+	for i := range providers {
+		p := &providers[i]
+		if err := p.compile(); err != nil {
+			return nil, err
+		}
+		registry.providers = append(registry.providers, p)
+	}
+	return registry, nil
+}
+
+// defaultProviders the built-in providers only
+var defaultProviders, _ = NewProviderRegistry(nil)
+
+func (p *Provider) compile() error {
+	var err error
+	if p.Name != iframeProvider.Name {
+		if p.Name == "" || len(p.Hosts) == 0 || p.Pattern == "" {
+			return fmt.Errorf("provider %q needs a name, hosts and a pattern", p.Name)
+		}
+		if p.pattern, err = regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf("provider %s: %w", p.Name, err)
+		}
+	}
+	if p.Template == "" && p.Embed == "" {
+		return fmt.Errorf("provider %s needs an embed url or a template", p.Name)
+	}
+	parse := func(name, text, fallback string) (*template.Template, error) {
+		if text == "" {
+			text = fallback
+		}
+		t, err := template.New(name).Funcs(template.FuncMap{"escapeQuotes": escapeQuotes}).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s %s: %w", p.Name, name, err)
+		}
+		return t, nil
+	}
+	if p.embed, err = parse("embed", p.Embed, ""); err != nil {
+		return err
+	}
+	if p.template, err = parse("template", p.Template, defaultProviderTemplate); err != nil {
+		return err
+	}
+	p.commonMark, err = parse("commonmark", p.CommonMark, defaultProviderCommonMark)
+	return err
+}
+
+// Match the provider of rawURL, nil when none recognises it
+func (r *ProviderRegistry) Match(rawURL string) *ProviderMatch {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	target := u.EscapedPath()
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	for _, p := range r.providers {
+		if !matchHost(host, p.Hosts) {
+			continue
+		}
+		groups := p.pattern.FindStringSubmatch(target)
+		if groups == nil {
+			continue
+		}
+		m := &ProviderMatch{Provider: p, Url: rawURL, Params: make(map[string]string)}
+		var first string
+		for i, name := range p.pattern.SubexpNames() {
+			if i == 0 || groups[i] == "" {
+				continue
+			}
+			if name != "" {
+				m.Params[name] = groups[i]
+			}
+			if first == "" {
+				first = groups[i]
+			}
+			if m.Id == "" && strings.HasPrefix(name, "id") {
+				m.Id = groups[i]
+			}
+		}
+		if m.Id == "" {
+			m.Id = first
+		}
+		if m.embed() == nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// Fallback the sandboxed iframe of a url no provider recognises
+func (r *ProviderRegistry) Fallback(rawURL string) (*ProviderMatch, error) {
+	m := &ProviderMatch{Provider: r.fallback, Url: strings.TrimSpace(rawURL), Params: make(map[string]string)}
+	if err := m.embed(); err != nil {
+		return nil, fmt.Errorf("provider %s: %w", r.fallback.Name, err)
+	}
+	return m, nil
+}
+
+// embed fills the embed url and the iframe sizing
+func (m *ProviderMatch) embed() error {
+	p := m.Provider
+	var embed bytes.Buffer
+	if err := p.embed.Execute(&embed, m); err != nil {
+		return err
+	}
+	m.EmbedUrl = embed.String()
+	m.Width, m.Height = p.Width, p.Height
+	if m.Width == "" {
+		m.Width = defaultEmbedWidth
+	}
+	if m.Height == "" {
+		m.Height = defaultEmbedHeight
+	}
+	m.Ratio, m.Sandbox = p.Ratio, p.Sandbox
+	m.AspectRatio = strings.Replace(p.Ratio, ":", " / ", 1)
+	return nil
+}
+
+// Render the output of the match for flavor
+func (m *ProviderMatch) Render(flavor string) (string, error) {
+	t := m.Provider.template
+	if flavor != "" && flavor != FlavorHugo {
+		t = m.Provider.commonMark
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, m); err != nil {
+		return "", fmt.Errorf("provider %s: %w", m.Provider.Name, err)
+	}
+	return out.String(), nil
+}
+
+func matchHost(host string, hosts []string) bool {
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+var providerCases = map[string][]struct{ url, id, hugo string }{
+	"youtube": {
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42", "dQw4w9WgXcQ", `{{< youtube id="dQw4w9WgXcQ" >}}`},
+		{"https://youtube.com/shorts/dQw4w9WgXcQ?feature=share", "dQw4w9WgXcQ", `{{< youtube id="dQw4w9WgXcQ" >}}`},
+		{"https://youtu.be/dQw4w9WgXcQ?si=abc", "dQw4w9WgXcQ", `{{< youtube id="dQw4w9WgXcQ" >}}`},
+	},
+	"vimeo": {
+		{"https://vimeo.com/76979871", "76979871", `{{< vimeo id="76979871" >}}`},
+		{"https://player.vimeo.com/video/76979871?h=1", "76979871", `{{< vimeo id="76979871" >}}`},
+	},
+	"bilibili": {
+		{"https://www.bilibili.com/video/BV1xx411c7mD/?spm_id_from=333", "BV1xx411c7mD", `{{< bilibili BV1xx411c7mD >}}`},
+		{"https://player.bilibili.com/player.html?aid=1&bvid=BV1xx411c7mD&cid=2", "BV1xx411c7mD", `{{< bilibili BV1xx411c7mD >}}`},
+		{"https://www.bilibili.com/video/av170001", "av170001", `{{< bilibili av170001 >}}`},
+	},
+	"loom": {
+		{"https://www.loom.com/share/0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef",
+			`{{< iframe "https://www.loom.com/embed/0123456789abcdef0123456789abcdef" "100%" "450" "16:9" "" >}}`},
+	},
+	"twitter": {
+		{"https://twitter.com/SanDiegoZoo/status/1512067081398673415", "1512067081398673415", `{{< x user="SanDiegoZoo" id="1512067081398673415" >}}`},
+		{"https://x.com/SanDiegoZoo/status/1512067081398673415?s=20", "1512067081398673415", `{{< x user="SanDiegoZoo" id="1512067081398673415" >}}`},
+	},
+	"gist": {
+		{"https://gist.github.com/spf13/7896402", "7896402", `{{< gist spf13 7896402 >}}`},
+	},
+	"jsfiddle": {
+		{"https://jsfiddle.net/user/abc123/", "user/abc123", `{{< jsfiddle url="user/abc123" >}}`},
+	},
+	"codepen": {
+		{"https://codepen.io/team/pen/PwZYjRo", "PwZYjRo", `{{< iframe "https://codepen.io/team/embed/PwZYjRo?default-tab=result" "100%" "450" >}}`},
+	},
+	"figma": {
+		{"https://www.figma.com/design/AbC123/Site?node-id=1-2", "AbC123",
+			`{{< iframe "https://www.figma.com/embed?embed_host=share&url=https%3A%2F%2Fwww.figma.com%2Fdesign%2FAbC123%2FSite%3Fnode-id%3D1-2" "100%" "600" >}}`},
+		{"https://www.figma.com/proto/XyZ789/Flow", "XyZ789",
+			`{{< iframe "https://www.figma.com/embed?embed_host=share&url=https%3A%2F%2Fwww.figma.com%2Fproto%2FXyZ789%2FFlow" "100%" "600" >}}`},
+	},
+	"google-maps": {
+		{"https://www.google.com/maps/place/Eiffel+Tower/@48.85,2.29,17z", "Eiffel+Tower",
+			`{{< iframe "https://maps.google.com/maps?q=Eiffel+Tower&output=embed" "100%" "450" >}}`},
+	},
+	"spotify": {
+		{"https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC?si=1", "4uLU6hMCjMI75M1A2tKUQC",
+			`{{< iframe "https://open.spotify.com/embed/track/4uLU6hMCjMI75M1A2tKUQC" "100%" "450" >}}`},
+	},
+	"google-docs": {
+		{"https://docs.google.com/document/d/1AbC-dEf_123/edit?usp=sharing", "1AbC-dEf_123",
+			`{{< iframe "https://docs.google.com/document/d/1AbC-dEf_123/preview" "100%" "800" >}}`},
+		{"https://docs.google.com/document/d/e/2PACX-1vQ/pub", "2PACX-1vQ",
+			`{{< iframe "https://docs.google.com/document/d/e/2PACX-1vQ/pub?embedded=true" "100%" "800" >}}`},
+	},
+	"google-sheets": {
+		{"https://docs.google.com/spreadsheets/d/1AbC-dEf_123/edit#gid=0", "1AbC-dEf_123",
+			`{{< iframe "https://docs.google.com/spreadsheets/d/1AbC-dEf_123/preview" "100%" "600" >}}`},
+		{"https://docs.google.com/spreadsheets/d/e/2PACX-1vQ/pubhtml", "2PACX-1vQ",
+			`{{< iframe "https://docs.google.com/spreadsheets/d/e/2PACX-1vQ/pubhtml?widget=true&headers=false" "100%" "600" >}}`},
+	},
+	"google-slides": {
+		{"https://docs.google.com/presentation/d/1AbC-dEf_123/edit#slide=id.p", "1AbC-dEf_123",
+			`{{< iframe "https://docs.google.com/presentation/d/1AbC-dEf_123/embed" "100%" "450" "16:9" "" >}}`},
+		{"https://docs.google.com/presentation/d/e/2PACX-1vQ/pub?start=false", "2PACX-1vQ",
+			`{{< iframe "https://docs.google.com/presentation/d/e/2PACX-1vQ/embed" "100%" "450" "16:9" "" >}}`},
+	},
+	"google-drive": {
+		{"https://drive.google.com/file/d/1AbC-dEf_123/view?usp=sharing", "1AbC-dEf_123",
+			`{{< iframe "https://drive.google.com/file/d/1AbC-dEf_123/preview" "100%" "450" "4:3" "" >}}`},
+		{"https://drive.google.com/open?id=1AbC-dEf_123", "1AbC-dEf_123",
+			`{{< iframe "https://drive.google.com/file/d/1AbC-dEf_123/preview" "100%" "450" "4:3" "" >}}`},
+		{"https://drive.google.com/drive/u/0/folders/1Fold-Er_9", "1Fold-Er_9",
+			`{{< iframe "https://drive.google.com/embeddedfolderview?id=1Fold-Er_9#list" "100%" "450" >}}`},
+	},
+}
+
+func TestBuiltinProviders(t *testing.T) {
+	for _, p := range builtinProviders {
+		if _, ok := providerCases[p.Name]; !ok {
+			t.Errorf("provider %s has no test case", p.Name)
+		}
+	}
+	for name, cases := range providerCases {
+		t.Run(name, func(t *testing.T) {
+			for _, c := range cases {
+				m := defaultProviders.Match(c.url)
+				if m == nil || m.Provider.Name != name || m.Id != c.id {
+					t.Fatalf("%s: got %+v", c.url, m)
+				}
+				if got, err := m.Render(FlavorHugo); err != nil || got != c.hugo {
+					t.Errorf("%s: got %s, %v, want %s", c.url, got, err, c.hugo)
+				}
+			}
+		})
+	}
+}
+
+func TestBilibiliEmbed(t *testing.T) {
+	cases := map[string]string{
+		"https://www.bilibili.com/video/BV1xx411c7mD": "https://player.bilibili.com/player.html?bvid=BV1xx411c7mD",
+		// old av ids are played by aid
+		"https://www.bilibili.com/video/av170001": "https://player.bilibili.com/player.html?aid=170001",
+	}
+	for rawURL, want := range cases {
+		if m := defaultProviders.Match(rawURL); m == nil || m.EmbedUrl != want {
+			t.Errorf("%s: got %+v, want %s", rawURL, m, want)
+		}
+	}
+}
+
+func TestProviderMismatch(t *testing.T) {
+	for _, url := range []string{
+		"https://notyoutube.com/watch?v=dQw4w9WgXcQ",
+		"https://docs.google.com/forms/d/1abc/viewform",
+		"https://github.com/nonacosa/notion-site",
+		"not a url",
+	} {
+		if m := defaultProviders.Match(url); m != nil {
+			t.Errorf("%s: unexpected provider %s", url, m.Provider.Name)
+		}
+	}
+}
+
+func TestCustomProviders(t *testing.T) {
+	registry, err := NewProviderRegistry([]Provider{
+		{Name: "youtube", Hosts: []string{"youtube.com"}, Pattern: `v=(?P<id>[\w-]+)`, Template: `{{"{{< lite-youtube "}}{{ .Id }}{{" >}}"}}`},
+		{Name: "miro", Hosts: []string{"miro.com"}, Pattern: `^/app/board/(?P<id>[\w=-]+)`, Embed: "https://miro.com/app/live-embed/{{ .Id }}/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := registry.Match("https://www.youtube.com/watch?v=dQw4w9WgXcQ").Render(FlavorHugo); got != "{{< lite-youtube dQw4w9WgXcQ >}}" {
+		t.Errorf("youtube should be replaced, got %s", got)
+	}
+	if m := registry.Match("https://youtu.be/dQw4w9WgXcQ"); m != nil {
+		t.Errorf("all built-in youtube providers should be replaced, got %+v", m)
+	}
+	want := `<iframe src="https://miro.com/app/live-embed/uXjVK=/" width="100%" height="450" frameborder="0" allowfullscreen></iframe>`
+	if got, _ := registry.Match("https://miro.com/app/board/uXjVK=/").Render(FlavorCommonMark); got != want {
+		t.Errorf("got %s", got)
+	}
+
+	// the fallback iframe is configured by name, without hosts or pattern
+	registry, err = NewProviderRegistry([]Provider{{Name: "iframe", Sandbox: "allow-scripts", Ratio: "4:3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := registry.Fallback("https://example.com/widget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `<iframe src="https://example.com/widget" width="100%" height="450" style="aspect-ratio: 4 / 3; height: auto" sandbox="allow-scripts" frameborder="0" allowfullscreen></iframe>`
+	if got, _ := m.Render(FlavorCommonMark); got != want {
+		t.Errorf("got %s", got)
+	}
+
+	if _, err := NewProviderRegistry([]Provider{{Name: "broken", Hosts: []string{"a.com"}, Pattern: "("}}); err == nil {
+		t.Error("invalid pattern should fail")
+	}
+}
+
+func TestEmbedTemplates(t *testing.T) {
+	cases := []struct {
+		bType string
+		block notion.Block
+		want  string
+	}{
+		{"video", &notion.VideoBlock{Type: notion.FileTypeExternal, External: &notion.FileExternal{URL: "https://youtu.be/dQw4w9WgXcQ"}},
+			"\n{{< youtube id=\"dQw4w9WgXcQ\" >}}\n\n"},
+		{"video", &notion.VideoBlock{Type: notion.FileTypeFile, File: &notion.FileFile{URL: "media/demo.mp4"}},
+			"\n{{< video src=\"media/demo.mp4\" >}}\n\n"},
+		{"embed", &notion.EmbedBlock{URL: "https://example.com/widget"},
+			"\n{{< iframe \"https://example.com/widget\" \"100%\" \"450\" \"\" \"allow-scripts allow-same-origin allow-popups allow-forms allow-presentation\" >}}\n\n"},
+		{"link_preview", &notion.LinkPreviewBlock{URL: "https://gist.github.com/spf13/7896402"},
+			"{{< gist spf13 7896402 >}}\n"},
+	}
+	tm := New()
+	tm.NotionProps = &NotionProp{}
+	for _, c := range cases {
+		extra := map[string]any{}
+		var err error
+		switch block := c.block.(type) {
+		case *notion.VideoBlock:
+			err = tm.injectVideoInfo(block, &extra)
+		case *notion.EmbedBlock:
+			err = tm.injectEmbedInfo(block, &extra)
+		case *notion.LinkPreviewBlock:
+			err = tm.injectLinkPreviewInfo(block, &extra)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		tm.ContentBuffer = new(bytes.Buffer)
+		if err := tm.GenBlock(c.bType, MdBlock{Block: c.block, Extra: extra}, false, true); err != nil {
+			t.Fatal(err)
+		}
+		if got := tm.ContentBuffer.String(); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.bType, got, c.want)
+		}
+	}
+}
+
+func TestEmbedExtraPerBlock(t *testing.T) {
+	tm := New()
+	tm.NotionProps = &NotionProp{}
+	tm.Files = &Files{queue: newMediaQueue()}
+	blocks := []notion.Block{
+		&notion.VideoBlock{Type: notion.FileTypeExternal, External: &notion.FileExternal{URL: "https://youtu.be/dQw4w9WgXcQ"}},
+		&notion.VideoBlock{Type: notion.FileTypeExternal, External: &notion.FileExternal{URL: "https://example.com/clip.mp4"}},
+		&notion.ImageBlock{Type: notion.FileTypeExternal, External: &notion.FileExternal{URL: "media/cat.png"}},
+	}
+	if err := tm.GenContentBlocks(blocks, 0); err != nil {
+		t.Fatal(err)
+	}
+	got := tm.ContentBuffer.String()
+	for _, want := range []string{`{{< youtube id="dQw4w9WgXcQ" >}}`, `{{< video src="https://example.com/clip.mp4" >}}`, "![](@@media:1@@)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in %q", want, got)
+		}
+	}
+	if strings.Count(got, "youtube") != 1 {
+		t.Errorf("the youtube embed leaked into the next blocks: %q", got)
+	}
+}
+
+func TestEmbedSizeKeys(t *testing.T) {
+	tm := New()
+	tm.NotionProps = &NotionProp{}
+	tm.Files = &Files{queue: newMediaQueue()}
+	extra := map[string]any{}
+	if err := tm.injectMatch(defaultProviders.Match("https://youtu.be/dQw4w9WgXcQ"), &extra); err != nil {
+		t.Fatal(err)
+	}
+	if extra["EmbedWidth"] != "100%" || extra["EmbedHeight"] != "450" {
+		t.Errorf("got %v", extra)
+	}
+	// an image rendered after the embed keeps its own size
+	image := &notion.ImageBlock{Type: notion.FileTypeExternal, External: &notion.FileExternal{URL: "media/cat.png"}}
+	if err := tm.injectImageInfo(image, "", &extra); err != nil {
+		t.Fatal(err)
+	}
+	tm.ContentBuffer = new(bytes.Buffer)
+	if err := tm.GenBlock("image", MdBlock{Block: image, Extra: extra}, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := tm.ContentBuffer.String(); strings.Contains(got, "width") || strings.Contains(got, "450") {
+		t.Errorf("embed size leaked into the image: %q", got)
+	}
+}
@@ -3,8 +3,8 @@ package pkg
 import (
 	"fmt"
 	"github.com/dstotijn/go-notion"
-	"github.com/otiai10/opengraph"
 	"reflect"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -25,71 +25,169 @@ func escapeQuotes(s string) string {
 	return strings.TrimSpace(s)
 }
 
-// injectBookmarkInfo set bookmark info into the extra map field
+// injectBookmarkInfo set bookmark info into the extra map field. Pages that
+// can't be fetched degrade to a plain link titled by the caption.
 func (tm *ToMarkdown) injectBookmarkInfo(bookmark *notion.BookmarkBlock, extra *map[string]any) error {
-	og, err := opengraph.Fetch(bookmark.URL)
+	meta, err := tm.Files.bookmarks.Fetch(bookmark.URL, tm.Files.Offline)
 	if err != nil {
-		return err
-	}
-	og.ToAbsURL()
-	for _, img := range og.Image {
-		if img != nil && img.URL != "" {
-			(*extra)["Image"] = img.URL
-			break
-		}
+		fmt.Printf("⚠ Bookmark %s: %s\n", bookmark.URL, err)
+		meta = BookmarkMeta{URL: bookmark.URL, Title: plainText(ConvertRichText(bookmark.Caption))}
 	}
-	(*extra)["Url"] = og.URL
-	(*extra)["Title"] = escapeQuotes(og.Title)
-	(*extra)["Description"] = escapeQuotes(og.Description)
-	(*extra)["Icon"] = og.Favicon
+	tm.injectBookmarkMeta(meta, extra)
 	return nil
 }
 
+func (tm *ToMarkdown) injectBookmarkMeta(meta BookmarkMeta, extra *map[string]any) {
+	if meta.Title == "" {
+		meta.Title = meta.URL
+	}
+	if tm.Files.BookmarkImages {
+		meta.Image = tm.Files.downloadOptional(meta.Image)
+		meta.Icon = tm.Files.downloadOptional(meta.Icon)
+	}
+	(*extra)["Url"] = meta.URL
+	(*extra)["Title"] = escapeQuotes(meta.Title)
+	(*extra)["Description"] = escapeQuotes(meta.Description)
+	(*extra)["Image"] = meta.Image
+	(*extra)["Icon"] = meta.Icon
+}
+
+// injectVideoInfo videos of a known provider by their player, other videos
+// by their url. Uploaded videos are already downloaded.
 func (tm *ToMarkdown) injectVideoInfo(video *notion.VideoBlock, extra *map[string]any) error {
-	videoUrl := video.External.URL
-	var id, plat string
-	if strings.Contains(videoUrl, "youtube") {
-		plat = "youtube"
-		id = FindUrlContext(RegexYoutube, videoUrl)
-	}
-	(*extra)["Plat"] = plat
-	(*extra)["Id"] = id
+	var src string
+	if video.Type == notion.FileTypeExternal && video.External != nil {
+		src = video.External.URL
+		if ok, err := tm.injectProvider(src, extra); ok || err != nil {
+			return err
+		}
+	}
+	if video.Type == notion.FileTypeFile && video.File != nil {
+		src = video.File.URL
+	}
+	(*extra)["Src"] = src
 	return nil
 }
 
+// injectEmbedInfo embeds unrecognised urls in a sandboxed iframe
 func (tm *ToMarkdown) injectEmbedInfo(embed *notion.EmbedBlock, extra *map[string]any) error {
-	var plat = ""
-	url := embed.URL
-	if len(url) == 0 {
+	(*extra)["Url"] = embed.URL
+	if ok, err := tm.injectProvider(embed.URL, extra); ok || err != nil {
+		return err
+	}
+	m, err := tm.providers().Fallback(embed.URL)
+	if err != nil {
+		return err
+	}
+	return tm.injectMatch(m, extra)
+}
+
+// injectLinkPreviewInfo embeds what a provider knows, cards for the rest:
+// github urls are described offline, other pages by their bookmark metadata
+func (tm *ToMarkdown) injectLinkPreviewInfo(preview *notion.LinkPreviewBlock, extra *map[string]any) error {
+	(*extra)["Url"] = preview.URL
+	if ok, err := tm.injectProvider(preview.URL, extra); ok || err != nil {
+		return err
+	}
+	if ref, ok := parseGitHubURL(preview.URL); ok {
+		(*extra)["GitHub"] = ref
+		tm.injectBookmarkMeta(BookmarkMeta{URL: preview.URL, Title: ref.Title(), Description: ref.Description(), Icon: githubIcon}, extra)
 		return nil
-	} else {
-		if strings.Contains(url, Bilibili) {
-			url = FindUrlContext(RegexBili, url)
-			plat = "bilibili"
-		}
-		if strings.Contains(url, Jsfiddle) {
-			url = FindUrlContext(RegexJsfiddle, url)
-			plat = "Jsfiddle"
-		}
-		if strings.Contains(url, Twitter) || strings.Contains(url, X) {
-			// support both twitter.com and x.com URL formats
-			user := FindUrlContext(RegexTwitterUser, url)
-			id := FindUrlContext(RegexTwitterId, url)
-			url = id
-			plat = "twitter"
-			(*extra)["User"] = user
-		}
-		if strings.Contains(url, Gist) {
-			url = strings.Join(strings.Split(FindTextP(url, Gist), "/"), " ")
-			plat = "gist"
-		}
+	}
+	meta, err := tm.Files.bookmarks.Fetch(preview.URL, tm.Files.Offline)
+	if err != nil {
+		fmt.Printf("⚠ Link preview %s: %s\n", preview.URL, err)
+		meta = BookmarkMeta{URL: preview.URL}
+	}
+	tm.injectBookmarkMeta(meta, extra)
+	return nil
+}
 
+// injectProvider renders rawURL with the provider recognising it, see Provider
+func (tm *ToMarkdown) injectProvider(rawURL string, extra *map[string]any) (bool, error) {
+	m := tm.providers().Match(rawURL)
+	if m == nil {
+		return false, nil
 	}
-	(*extra)["Url"] = url
-	(*extra)["Plat"] = plat
+	return true, tm.injectMatch(m, extra)
+}
+
+func (tm *ToMarkdown) providers() *ProviderRegistry {
+	if tm.Providers == nil {
+		return defaultProviders
+	}
+	return tm.Providers
+}
+
+// injectMatch the iframe sizes are kept under Embed* keys, away from the image ones
+func (tm *ToMarkdown) injectMatch(m *ProviderMatch, extra *map[string]any) error {
+	embed, err := m.Render(tm.Flavor)
+	if err != nil {
+		return err
+	}
+	(*extra)["Plat"] = m.Provider.Name
+	(*extra)["Id"] = m.Id
+	(*extra)["Params"] = m.Params
+	(*extra)["EmbedUrl"] = m.EmbedUrl
+	(*extra)["EmbedWidth"] = m.Width
+	(*extra)["EmbedHeight"] = m.Height
+	(*extra)["EmbedRatio"] = m.Ratio
+	(*extra)["EmbedSandbox"] = m.Sandbox
+	(*extra)["Embed"] = embed
 	return nil
 }
 
+// injectImageInfo alt text, caption and dimensions of an image. A caption
+// "alt | caption" gives the alt text and the visible caption apart.
+func (tm *ToMarkdown) injectImageInfo(image *notion.ImageBlock, original string, extra *map[string]any) error {
+	alt, caption := splitImageCaption(image.Caption)
+	(*extra)["Alt"] = alt
+	(*extra)["Caption"] = caption
+	(*extra)["CaptionText"] = plainText(caption)
+	(*extra)["Figure"] = tm.ImageFigure
+	if tm.ImageLinkOriginal {
+		(*extra)["Link"] = original
+	}
+	(*extra)["Size"] = ""
+	if tm.Files.images.Enabled() {
+		(*extra)["Size"] = tm.Files.mediaSize(imageURL(image))
+	}
+	return nil
+}
+
+func imageURL(image *notion.ImageBlock) string {
+	if image.Type == notion.FileTypeExternal {
+		return image.External.URL
+	}
+	if image.Type == notion.FileTypeFile {
+		return image.File.URL
+	}
+	return ""
+}
+
+// splitImageCaption plain alt text and markdown caption
+func splitImageCaption(rich []notion.RichText) (alt, caption string) {
+	var plain strings.Builder
+	for _, r := range rich {
+		plain.WriteString(r.PlainText)
+	}
+	caption = ConvertRichText(rich)
+	alt = plain.String()
+	if before, _, found := strings.Cut(alt, "|"); found {
+		alt = before
+		_, caption, _ = strings.Cut(caption, "|")
+	}
+	return strings.TrimSpace(alt), strings.TrimSpace(caption)
+}
+
+// plainText drops the markdown emphasis and links of s
+func plainText(s string) string {
+	s = markdownLink.ReplaceAllString(s, "$1")
+	return strings.TrimSpace(strings.NewReplacer("***", "", "**", "", "__", "", "*", "", "`", "").Replace(s))
+}
+
+var markdownLink = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+
 // todo real file position
 func (tm *ToMarkdown) injectFileInfo(file any, extra *map[string]any) error {
 	var url string
@@ -121,8 +219,7 @@ func (tm *ToMarkdown) injectFileInfo(file any, extra *map[string]any) error {
 		}
 	}
 	(*extra)["Url"] = url
-	name, _ := RemoveSuffix(url)
-	(*extra)["FileName"] = name
+	(*extra)["FileName"] = tm.Files.mediaName(url)
 	return nil
 }
 
@@ -168,16 +265,30 @@ func (tm *ToMarkdown) injectFrontMatter(key string, property notion.DatabasePage
 		fmv = prop.Name
 		tm.injectAuthorAvatar(prop.AvatarURL)
 	case *notion.File:
-		fmv = prop.File.URL
+		if prop != nil {
+			fmv = tm.downloadFrontMatterFile(*prop)
+		}
 	case []notion.File:
-		// 最后一个图片最为 banner
-		fmt.Printf("")
-		for i, image := range prop {
-			if i == len(prop)-1 {
-				// todo notion image download real path
-				fmv = fmt.Sprintf("image|%s", image.File.URL)
+		// string fields like image can't hold a list, only their first file is downloaded
+		first := tm.FrontMatterFiles == FrontMatterFilesFirst || isStringFrontMatterField(key)
+		paths := make([]string, 0, len(prop))
+		for _, file := range prop {
+			if path := tm.downloadFrontMatterFile(file); path != "" {
+				paths = append(paths, path)
+				if first {
+					break
+				}
 			}
 		}
+		if len(paths) == 0 {
+			return
+		}
+		if first {
+			fmv = paths[0]
+		} else {
+			fmv = paths
+		}
+		tm.mediaFrontMatter[strings.ToLower(key)] = fmv
 	case *notion.FileExternal:
 		fmv = prop.URL
 	case *notion.FileFile:
@@ -245,23 +356,100 @@ func (tm *ToMarkdown) injectFrontMatterCover(cover *notion.Cover) {
 	if cover == nil {
 		return
 	}
-	image := &notion.FileBlock{
-		Type:     cover.Type,
-		File:     cover.File,
-		External: cover.External,
+	image := &notion.FileBlock{Type: cover.Type}
+	if cover.File != nil {
+		image.File = &notion.FileFile{URL: cover.File.URL}
+	}
+	if cover.External != nil {
+		image.External = &notion.FileExternal{URL: cover.External.URL}
 	}
 
 	if err := tm.Files.DownloadMedia(image); err != nil {
+		fmt.Println("⚠ Downloading cover:", err)
 		return
 	}
 	if image.Type == notion.FileTypeExternal {
-		tm.FrontMatter["image"] = image.External.URL
+		tm.setMediaFrontMatter(tm.coverKey(), image.External.URL)
 	}
 	if image.Type == notion.FileTypeFile {
-		tm.FrontMatter["image"] = image.File.URL
+		tm.setMediaFrontMatter(tm.coverKey(), image.File.URL)
+	}
+}
+
+// injectFrontMatterIcon emoji icons as text, file icons downloaded
+func (tm *ToMarkdown) injectFrontMatterIcon(icon *notion.Icon) {
+	if icon == nil {
+		return
+	}
+	switch {
+	case icon.Type == notion.IconTypeEmoji && icon.Emoji != nil:
+		tm.setMediaFrontMatter(tm.iconKey(), *icon.Emoji)
+	case icon.Type == notion.IconTypeExternal && icon.External != nil:
+		tm.setMediaFrontMatter(tm.iconKey(), tm.downloadFrontMatterImage(icon.External.URL))
+	case icon.Type == notion.IconTypeFile && icon.File != nil:
+		tm.setMediaFrontMatter(tm.iconKey(), tm.downloadFrontMatterImage(icon.File.URL))
 	}
 }
 
+// injectOGCard uses a generated social card as cover, unless the page
+// has one from its properties
+func (tm *ToMarkdown) injectOGCard(title string) {
+	if tm.OGCard == nil || title == "" {
+		return
+	}
+	for key, value := range tm.FrontMatter {
+		if strings.EqualFold(key, tm.coverKey()) && !isEmptyValue(value) {
+			return
+		}
+	}
+	data, err := tm.OGCard.Render(title)
+	if err == nil {
+		var link string
+		if link, err = tm.Files.storeGenerated("og-card", ".png", data); err == nil {
+			tm.setMediaFrontMatter(tm.coverKey(), link)
+			return
+		}
+	}
+	fmt.Println("⚠ Generating og card:", err)
+}
+
+func (tm *ToMarkdown) coverKey() string {
+	if tm.CoverKey != "" {
+		return tm.CoverKey
+	}
+	return defaultCoverKey
+}
+
+func (tm *ToMarkdown) iconKey() string {
+	if tm.IconKey != "" {
+		return tm.IconKey
+	}
+	return defaultIconKey
+}
+
+// setMediaFrontMatter keeps value under key even if FrontMatter has no such field
+func (tm *ToMarkdown) setMediaFrontMatter(key string, value any) {
+	if value == "" {
+		return
+	}
+	tm.FrontMatter[key] = value
+	tm.mediaFrontMatter[strings.ToLower(key)] = value
+}
+
+// injectPageFrontMatter front matter of a standalone (non database) page
+func (tm *ToMarkdown) injectPageFrontMatter(page notion.Page) {
+	tm.FrontMatter["CreateAt"] = page.CreatedTime.Format(time.RFC3339)
+	tm.FrontMatter["LastMod"] = page.LastEditedTime.Format(time.RFC3339)
+}
+
+// injectChildPageInfo link to the folder the child page is written to. Only
+// the child pages a page tree walks are written, the others, and those that
+// failed, stay titles.
+func (tm *ToMarkdown) injectChildPageInfo(page *notion.ChildPageBlock, extra *map[string]any) error {
+	(*extra)["Url"] = tm.TreeChildren[page.ID()]
+	return nil
+}
+
 func (tm *ToMarkdown) todo(video any, extra *map[string]any) error {
 	return nil
 }
@@ -271,17 +459,36 @@ func (tm *ToMarkdown) inject(mdb *MdBlock, blocks []notion.Block, index int) err
 	block := mdb.Block
 	switch reflect.TypeOf(block) {
 	case reflect.TypeOf(&notion.ImageBlock{}):
-		err = tm.Files.DownloadMedia(block.(*notion.ImageBlock))
+		image := block.(*notion.ImageBlock)
+		// uploaded images are signed urls expiring within the hour, they link
+		// to the downloaded copy
+		var original string
+		if image.Type == notion.FileTypeExternal {
+			original = imageURL(image)
+		}
+		if err = tm.Files.DownloadMedia(image); err == nil {
+			if original == "" {
+				original = imageURL(image)
+			}
+			err = tm.injectImageInfo(image, original, &mdb.Extra)
+		}
 	//todo hugo
 	case reflect.TypeOf(&notion.BookmarkBlock{}):
 		err = tm.injectBookmarkInfo(block.(*notion.BookmarkBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.VideoBlock{}):
-		err = tm.injectVideoInfo(block.(*notion.VideoBlock), &mdb.Extra)
+		video := block.(*notion.VideoBlock)
+		if video.Type == notion.FileTypeFile {
+			err = tm.Files.DownloadMedia(video)
+		}
+		if err == nil {
+			err = tm.injectVideoInfo(video, &mdb.Extra)
+		}
 	case reflect.TypeOf(&notion.FileBlock{}):
-		err = tm.Files.DownloadMedia(block.(*notion.FileBlock))
-		err = tm.injectFileInfo(block.(*notion.FileBlock), &mdb.Extra)
+		if err = tm.Files.DownloadMedia(block.(*notion.FileBlock)); err == nil {
+			err = tm.injectFileInfo(block.(*notion.FileBlock), &mdb.Extra)
+		}
 	case reflect.TypeOf(&notion.LinkPreviewBlock{}):
-		err = tm.todo(block.(*notion.LinkPreviewBlock), &mdb.Extra)
+		err = tm.injectLinkPreviewInfo(block.(*notion.LinkPreviewBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.LinkToPageBlock{}):
 		err = tm.todo(block.(*notion.LinkToPageBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.EmbedBlock{}):
@@ -293,31 +500,35 @@ func (tm *ToMarkdown) inject(mdb *MdBlock, blocks []notion.Block, index int) err
 	case reflect.TypeOf(&notion.ChildDatabaseBlock{}):
 		err = tm.todo(block.(*notion.ChildDatabaseBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.ChildPageBlock{}):
-		err = tm.todo(block.(*notion.ChildPageBlock), &mdb.Extra)
+		err = tm.injectChildPageInfo(block.(*notion.ChildPageBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.PDFBlock{}):
-		err = tm.Files.DownloadMedia(block.(*notion.PDFBlock))
-		err = tm.injectFileInfo(block.(*notion.PDFBlock), &mdb.Extra)
+		if err = tm.Files.DownloadMedia(block.(*notion.PDFBlock)); err == nil {
+			err = tm.injectFileInfo(block.(*notion.PDFBlock), &mdb.Extra)
+		}
 	case reflect.TypeOf(&notion.SyncedBlock{}):
 		err = tm.todo(block.(*notion.SyncedBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.TemplateBlock{}):
 		err = tm.todo(block.(*notion.TemplateBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.AudioBlock{}):
-		err = tm.Files.DownloadMedia(block.(*notion.AudioBlock))
-		err = tm.injectFileInfo(block.(*notion.AudioBlock), &mdb.Extra)
+		if err = tm.Files.DownloadMedia(block.(*notion.AudioBlock)); err == nil {
+			err = tm.injectFileInfo(block.(*notion.AudioBlock), &mdb.Extra)
+		}
 	case reflect.TypeOf(&notion.ToDoBlock{}):
 		mdb.Block = block.(*notion.ToDoBlock)
 	case reflect.TypeOf(&notion.TableBlock{}):
 		mdb.Block = block.(*notion.TableBlock)
+	case reflect.TypeOf(&notion.Heading1Block{}):
+		tm.injectHeadingInfo(1, block.(*notion.Heading1Block).RichText, &mdb.Extra)
+	case reflect.TypeOf(&notion.Heading2Block{}):
+		tm.injectHeadingInfo(2, block.(*notion.Heading2Block).RichText, &mdb.Extra)
+	case reflect.TypeOf(&notion.Heading3Block{}):
+		tm.injectHeadingInfo(3, block.(*notion.Heading3Block).RichText, &mdb.Extra)
+	case reflect.TypeOf(&notion.UnsupportedBlock{}):
+		// e.g. google drive blocks, the API gives neither their kind nor url
+		fmt.Printf("⚠ Unsupported block %s skipped, paste its link as an embed instead\n", block.ID())
 	}
-	return err
-}
-
-// ConvertTwitterExtraToX builds the Hugo x shortcode string from extra map
-func ConvertTwitterExtraToX(extra map[string]any) string {
-	user, _ := extra["User"].(string)
-	id, _ := extra["Url"].(string)
-	if user == "" || id == "" {
-		return ""
+	if err != nil {
+		return fmt.Errorf("%s block %s: %w", GetBlockType(block), block.ID(), err)
 	}
-	return fmt.Sprintf("{{< x user=\"%s\" id=\"%s\" >}}", user, id)
+	return nil
 }
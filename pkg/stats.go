@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"strings"
+	"unicode"
+)
+
+// reading speeds hugo uses, words per minute and CJK characters per minute
+const (
+	wordsPerMinute    = 213
+	cjkCharsPerMinute = 500
+)
+
+// PageStats text statistics of a page
+type PageStats struct {
+	WordCount int
+	// ReadingTime in minutes, at least 1 for pages with text
+	ReadingTime   int
+	IsCJKLanguage bool
+}
+
+// isCJK reports whether r is written without spaces between words
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// countWords words of text, each CJK character counting as one. It also
+// returns how many of them are CJK characters.
+func countWords(text string) (words, cjk int) {
+	inWord := false
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			words++
+			cjk++
+			inWord = false
+		case unicode.IsSpace(r) || unicode.IsPunct(r) && r != '\'' && r != '-':
+			inWord = false
+		default:
+			if !inWord {
+				words++
+			}
+			inWord = true
+		}
+	}
+	return words, cjk
+}
+
+// pageStats statistics of rendered markdown, CJK pages are the ones mostly
+// made of CJK characters
+func pageStats(md string) PageStats {
+	words, cjk := countWords(summaryText(md))
+	stats := PageStats{WordCount: words, IsCJKLanguage: words > 0 && cjk*2 > words}
+	perMinute := wordsPerMinute
+	if stats.IsCJKLanguage {
+		perMinute = cjkCharsPerMinute
+	}
+	if words > 0 {
+		stats.ReadingTime = (words + perMinute - 1) / perMinute
+	}
+	return stats
+}
+
+// injectStats writes the page statistics to the front matter, a page setting
+// isCJKLanguage itself keeps its value
+func (tm *ToMarkdown) injectStats() {
+	stats := pageStats(tm.ContentBuffer.String())
+	tm.FrontMatter["WordCount"] = stats.WordCount
+	tm.FrontMatter["ReadingTime"] = stats.ReadingTime
+	for key := range tm.FrontMatter {
+		if strings.EqualFold(key, "IsCJKLanguage") {
+			return
+		}
+	}
+	tm.FrontMatter["IsCJKLanguage"] = stats.IsCJKLanguage
+}
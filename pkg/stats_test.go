@@ -0,0 +1,53 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCountWords(t *testing.T) {
+	cases := []struct {
+		text       string
+		words, cjk int
+	}{
+		{"Hello, world! It's a well-known example.", 6, 0},
+		{"你好，世界", 4, 4},
+		{"用 Go 写一个 CLI 工具", 8, 6},
+		{"こんにちは 세계", 7, 7},
+		{"", 0, 0},
+	}
+	for _, c := range cases {
+		if words, cjk := countWords(c.text); words != c.words || cjk != c.cjk {
+			t.Errorf("%q: got %d words, %d cjk, want %d, %d", c.text, words, cjk, c.words, c.cjk)
+		}
+	}
+}
+
+func TestPageStats(t *testing.T) {
+	english := "## Title {#title}\n\n" + strings.Repeat("word ", 300) + "\n\n![img](@@media:1@@)\n"
+	if got := pageStats(english); got != (PageStats{WordCount: 301, ReadingTime: 2}) {
+		t.Errorf("got %+v", got)
+	}
+	chinese := "# 标题\n\n" + strings.Repeat("中文内容，", 100) + "with some English words"
+	if got := pageStats(chinese); got != (PageStats{WordCount: 406, ReadingTime: 1, IsCJKLanguage: true}) {
+		t.Errorf("got %+v", got)
+	}
+	if got := pageStats("{{< figure src=\"a.png\" >}}\n"); got != (PageStats{}) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestInjectStats(t *testing.T) {
+	tm := New()
+	tm.ContentBuffer.WriteString("中文内容")
+	tm.injectStats()
+	if tm.FrontMatter["WordCount"] != 4 || tm.FrontMatter["ReadingTime"] != 1 || tm.FrontMatter["IsCJKLanguage"] != true {
+		t.Errorf("got %v", tm.FrontMatter)
+	}
+	// the page decides
+	tm.FrontMatter = map[string]any{"isCJKLanguage": false}
+	tm.injectStats()
+	if tm.FrontMatter["isCJKLanguage"] != false || tm.FrontMatter["IsCJKLanguage"] != nil {
+		t.Errorf("got %v", tm.FrontMatter)
+	}
+}
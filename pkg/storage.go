@@ -0,0 +1,246 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	MediaStorageLocal = "local"
+	MediaStorageS3    = "s3"
+	// downloaded media are staged here before they are uploaded
+	defaultS3StagingPath = ".notion-media"
+	defaultS3Region      = "us-east-1"
+)
+
+// MediaStorage is where downloaded media are published. Media are always
+// downloaded into a local folder first, Publish makes dir/name available at
+// the public link the markdown uses.
+type MediaStorage interface {
+	Publish(dir, name string) error
+}
+
+// NewMediaStorage the storage selected by markdown.mediaStorage
+func NewMediaStorage(config Markdown) (MediaStorage, error) {
+	switch strings.ToLower(config.MediaStorage) {
+	case "", MediaStorageLocal:
+		return LocalStorage{}, nil
+	case MediaStorageS3:
+		return NewS3Storage(config.S3)
+	}
+	return nil, fmt.Errorf("unknown mediaStorage %s", config.MediaStorage)
+}
+
+// storageLocation where storage publishes to, media are published again
+// when it changes. Storages may tell it with a Location() string method.
+func storageLocation(storage MediaStorage) string {
+	if s, ok := storage.(interface{ Location() string }); ok {
+		return s.Location()
+	}
+	return fmt.Sprintf("%T", storage)
+}
+
+// LocalStorage serves the media from where they were downloaded.
+type LocalStorage struct{}
+
+func (LocalStorage) Publish(dir, name string) error {
+	return nil
+}
+
+func (LocalStorage) Location() string {
+	return MediaStorageLocal
+}
+
+// S3Storage uploads media to an S3 compatible bucket (AWS, MinIO, R2...).
+type S3Storage struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+func NewS3Storage(config S3) (*S3Storage, error) {
+	s := &S3Storage{
+		Endpoint:  strings.TrimSuffix(config.Endpoint, "/"),
+		Region:    config.Region,
+		Bucket:    config.Bucket,
+		Prefix:    strings.Trim(config.Prefix, "/"),
+		AccessKey: config.AccessKey,
+		SecretKey: config.SecretKey,
+		client:    &http.Client{Timeout: defaultDownloadTimeout},
+		now:       time.Now,
+	}
+	if s.Endpoint == "" {
+		s.Endpoint = "https://s3.amazonaws.com"
+	}
+	if s.Region == "" {
+		s.Region = defaultS3Region
+	}
+	if s.AccessKey == "" {
+		s.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if s.SecretKey == "" {
+		s.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("s3 storage needs a bucket and credentials")
+	}
+	return s, nil
+}
+
+// PublicURL where the uploaded media are served from, path style
+func (s *S3Storage) PublicURL() string {
+	return joinLink(s.Endpoint+"/"+s.Bucket, s.Prefix)
+}
+
+func (s *S3Storage) Location() string {
+	return MediaStorageS3 + ":" + s.PublicURL()
+}
+
+func (s *S3Storage) objectURL(name string) string {
+	key := name
+	if s.Prefix != "" {
+		key = s.Prefix + "/" + name
+	}
+	return s.Endpoint + "/" + s3Escape(s.Bucket, false) + "/" + s3Escape(key, true)
+}
+
+// Publish uploads dir/name, unless the bucket already has it: names are
+// content hashes, an existing object is the same file.
+func (s *S3Storage) Publish(dir, name string) error {
+	objectURL := s.objectURL(name)
+	req, err := http.NewRequest(http.MethodHead, objectURL, nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, emptyPayloadHash)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("s3 %s: %w", name, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	req, err = http.NewRequest(http.MethodPut, objectURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	sum := sha256.Sum256(data)
+	s.sign(req, hex.EncodeToString(sum[:]))
+	resp, err = s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("s3 upload %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3 upload %s: %s", name, resp.Status)
+	}
+	return nil
+}
+
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds an AWS signature version 4 Authorization header, signing the
+// host and every header already set on req.
+func (s *S3Storage) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	for _, part := range []string{s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape uri-encodes like aws does, object keys keep their slashes
+func s3Escape(s string, key bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 || key && c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/dstotijn/go-notion"
+)
+
+const moreTag = "<!--more-->"
+
+// default SummaryLength of each SummaryBreak
+var defaultSummaryLengths = map[string]int{
+	SummaryBytes:      60,
+	SummaryWords:      70,
+	SummaryParagraphs: 1,
+}
+
+// summaryMarker reports whether the top level block is the explicit break of
+// the divider or marker modes, rendered as the more tag instead of itself
+func (tm *ToMarkdown) summaryMarker(block notion.Block) bool {
+	if tm.hasMoreTag {
+		return false
+	}
+	switch tm.summaryBreak() {
+	case SummaryDivider:
+		_, ok := block.(*notion.DividerBlock)
+		return ok
+	case SummaryMarker:
+		p, ok := block.(*notion.ParagraphBlock)
+		return ok && strings.TrimSpace(ConvertRichText(p.RichText)) == moreTag
+	}
+	return false
+}
+
+// checkSummaryLength breaks after the top level block reaching SummaryLength
+func (tm *ToMarkdown) checkSummaryLength(block notion.Block) {
+	if tm.hasMoreTag {
+		return
+	}
+	length := tm.SummaryLength
+	if length <= 0 {
+		length = defaultSummaryLengths[tm.summaryBreak()]
+	}
+	switch tm.summaryBreak() {
+	case SummaryBytes:
+		if tm.ContentBuffer.Len() > length {
+			tm.genMoreTag()
+		}
+	case SummaryWords:
+		if words, _ := countWords(summaryText(tm.ContentBuffer.String())); words >= length {
+			tm.genMoreTag()
+		}
+	case SummaryParagraphs:
+		if p, ok := block.(*notion.ParagraphBlock); ok && strings.TrimSpace(ConvertRichText(p.RichText)) != "" {
+			tm.paragraphs++
+		}
+		if tm.paragraphs >= length {
+			tm.genMoreTag()
+		}
+	}
+}
+
+func (tm *ToMarkdown) summaryBreak() string {
+	if tm.SummaryBreak == "" {
+		return SummaryBytes
+	}
+	return tm.SummaryBreak
+}
+
+// genMoreTag ends the summary, the text so far becomes the summary front matter
+func (tm *ToMarkdown) genMoreTag() {
+	tm.hasMoreTag = true
+	tm.summary = summaryText(tm.ContentBuffer.String())
+	if tm.ContentBuffer.Len() > 0 && !strings.HasSuffix(tm.ContentBuffer.String(), "\n") {
+		tm.ContentBuffer.WriteString("\n")
+	}
+	tm.ContentBuffer.WriteString(moreTag + "\n\n")
+}
+
+var summaryStrip = []*regexp.Regexp{
+	regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`),          // images
+	regexp.MustCompile(`\{\{[<%].*?[%>]\}\}`),           // shortcodes
+	regexp.MustCompile(`<[^>]+>`),                       // html
+	regexp.MustCompile(`\[\^[^\]]+\]`),                  // footnote refs
+	regexp.MustCompile(`\s*\{#[^}]*\}`),                 // heading anchors
+	regexp.MustCompile(`(?m)^\s*(#+|>|[-*+]|\d+\.)\s+`), // block markers
+	regexp.MustCompile(`(?m)^(-{3,}|` + "```" + `.*)$`), // dividers and fences
+	regexp.MustCompile(`@@[\w-]+(:\d+)?@@`),             // toc and media tokens
+}
+
+// summaryText the plain text of markdown
+func summaryText(md string) string {
+	for _, re := range summaryStrip {
+		md = re.ReplaceAllString(md, "")
+	}
+	return strings.Join(strings.Fields(plainText(md)), " ")
+}
@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestSummaryBreak(t *testing.T) {
+	paragraph := func(s string) notion.Block { return &notion.ParagraphBlock{RichText: richText(s)} }
+	blocks := []notion.Block{
+		paragraph("The **first** paragraph of the post."),
+		&notion.BulletedListItemBlock{RichText: richText("a list item long enough to pass sixty bytes on its own")},
+		&notion.DividerBlock{},
+		paragraph(moreTag),
+		paragraph("The end."),
+	}
+	cases := []struct {
+		mode    string
+		length  int
+		summary string
+		// the more tag follows this text, "" for none
+		before string
+	}{
+		{"", 0, "The first paragraph of the post. a list item long enough to pass sixty bytes on its own", "its own\n\n"},
+		{SummaryWords, 5, "The first paragraph of the post.", "post.\n\n"},
+		{SummaryParagraphs, 1, "The first paragraph of the post.", "post.\n\n"},
+		{SummaryDivider, 0, "The first paragraph of the post. a list item long enough to pass sixty bytes on its own", "its own\n\n"},
+		{SummaryMarker, 0, "The first paragraph of the post. a list item long enough to pass sixty bytes on its own", "--------------------\n"},
+		{SummaryOff, 0, "", ""},
+	}
+	for _, c := range cases {
+		tm := New()
+		tm.NotionProps = &NotionProp{}
+		tm.SummaryBreak, tm.SummaryLength = c.mode, c.length
+		if err := tm.GenContentBlocks(blocks, 0); err != nil {
+			t.Fatal(err)
+		}
+		got := tm.ContentBuffer.String()
+		if tm.hasMoreTag != (c.before != "") {
+			t.Errorf("%q: more tag %v in %q", c.mode, tm.hasMoreTag, got)
+		}
+		if c.before != "" && !strings.Contains(got, c.before+moreTag+"\n") {
+			t.Errorf("%q: the more tag should follow %q in %q", c.mode, c.before, got)
+		}
+		if tm.summary != c.summary {
+			t.Errorf("%q: got summary %q, want %q", c.mode, tm.summary, c.summary)
+		}
+	}
+}
+
+func TestSummaryText(t *testing.T) {
+	md := "## Intro {#intro}\n\n![cat](@@media:1@@)\n\nSee [the **docs**](https://x.y)[^comment-1].\n\n" +
+		"{{< figure src=\"a.png\" >}}\n\n- one\n- two\n\n> quoted <br> text\n"
+	if got := summaryText(md); got != "Intro See the docs. one two quoted text" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// tocToken marks the table of contents until all headings are known
+const tocToken = "@@toc@@"
+
+// Heading of a page, nested under the previous higher level heading
+type Heading struct {
+	Level    int        `json:"level"`
+	Title    string     `json:"title"`
+	ID       string     `json:"id"`
+	Children []*Heading `json:"children,omitempty"`
+}
+
+// injectHeadingInfo gives the heading a unique anchor and records it for the toc
+func (tm *ToMarkdown) injectHeadingInfo(level int, richText []notion.RichText, extra *map[string]any) {
+	title := plainText(ConvertRichText(richText))
+	id := anchorID(title)
+	if id == "" {
+		id = "heading"
+	}
+	if tm.anchors == nil {
+		tm.anchors = make(map[string]int)
+	}
+	// duplicates are numbered like hugo does: intro, intro-1, intro-2
+	if n := tm.anchors[id]; n > 0 {
+		tm.anchors[id]++
+		id = fmt.Sprintf("%s-%d", id, n)
+	}
+	tm.anchors[id]++
+	tm.headings = append(tm.headings, Heading{Level: level, Title: title, ID: id})
+	(*extra)["Anchor"] = id
+}
+
+// anchorID the id hugo (and GitHub) derive from a heading: lower case letters
+// and digits of any script, spaces become dashes, punctuation is dropped
+func anchorID(title string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(title)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+// headingTree the page headings nested by level
+func (tm *ToMarkdown) headingTree() []*Heading {
+	return nestHeadings(tm.headings)
+}
+
+func nestHeadings(headings []Heading) []*Heading {
+	var roots, stack []*Heading
+	for i := range headings {
+		h := headings[i]
+		for len(stack) > 0 && stack[len(stack)-1].Level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, &h)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, &h)
+		}
+		stack = append(stack, &h)
+	}
+	return roots
+}
+
+// genTOC replaces the toc blocks with the list of the page headings
+func (tm *ToMarkdown) genTOC() {
+	content := tm.ContentBuffer.String()
+	if !strings.Contains(content, tocToken) {
+		return
+	}
+	var toc strings.Builder
+	var write func(headings []*Heading, depth int)
+	write = func(headings []*Heading, depth int) {
+		for _, h := range headings {
+			fmt.Fprintf(&toc, "%s- [%s](#%s)\n", strings.Repeat("  ", depth), h.Title, h.ID)
+			write(h.Children, depth+1)
+		}
+	}
+	write(tm.headingTree(), 0)
+	tm.ContentBuffer.Reset()
+	tm.ContentBuffer.WriteString(strings.ReplaceAll(content, tocToken, strings.TrimSuffix(toc.String(), "\n")))
+}
+
+var (
+	headingLine     = regexp.MustCompile(`^(#{1,6}) (.*)$`)
+	headingIDAttr   = regexp.MustCompile(`\{#([^}]*)\}\s*$`)
+	headingIDAnchor = regexp.MustCompile(`<a id="([^"]*)"></a>`)
+)
+
+// markdownHeadings the heading tree of rendered markdown, e.g. a translated
+// page, with the anchors it was rendered with
+func markdownHeadings(md string) []*Heading {
+	var headings []Heading
+	fenced := false
+	for _, line := range strings.Split(md, "\n") {
+		if strings.HasPrefix(line, "```") {
+			fenced = !fenced
+			continue
+		}
+		m := headingLine.FindStringSubmatch(line)
+		if fenced || m == nil {
+			continue
+		}
+		h := Heading{Level: len(m[1]), Title: summaryText(m[2])}
+		if id := headingIDAttr.FindStringSubmatch(m[2]); id != nil {
+			h.ID = id[1]
+		} else if id := headingIDAnchor.FindStringSubmatch(m[2]); id != nil {
+			h.ID = id[1]
+		} else {
+			h.ID = anchorID(h.Title)
+		}
+		headings = append(headings, h)
+	}
+	return nestHeadings(headings)
+}
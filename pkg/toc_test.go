@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestAnchorID(t *testing.T) {
+	cases := map[string]string{
+		"Getting Started":       "getting-started",
+		"What's new in v1.2?":   "whats-new-in-v12",
+		"快速开始 Quick start":      "快速开始-quick-start",
+		"Ünïcode & emoji 🚀":     "ünïcode--emoji-",
+		"snake_case-and-dashes": "snake_case-and-dashes",
+	}
+	for title, want := range cases {
+		if got := anchorID(title); got != want {
+			t.Errorf("%s: got %q, want %q", title, got, want)
+		}
+	}
+}
+
+func richText(s string) []notion.RichText {
+	return []notion.RichText{{Type: notion.RichTextTypeText, Text: &notion.Text{Content: s}}}
+}
+
+func TestTableOfContents(t *testing.T) {
+	blocks := []notion.Block{
+		&notion.TableOfContentsBlock{},
+		&notion.Heading1Block{RichText: richText("Intro")},
+		&notion.Heading2Block{RichText: richText("安装")},
+		&notion.Heading3Block{RichText: richText("**Linux**")},
+		&notion.Heading2Block{RichText: richText("Intro")},
+		&notion.Heading1Block{RichText: richText("Intro")},
+	}
+	for _, flavor := range []string{FlavorHugo, FlavorCommonMark} {
+		tm := New()
+		tm.NotionProps = &NotionProp{}
+		tm.Flavor = flavor
+		if err := tm.GenContentBlocks(blocks, 0); err != nil {
+			t.Fatal(err)
+		}
+		tm.genTOC()
+		got := tm.ContentBuffer.String()
+		toc := "- [Intro](#intro)\n  - [安装](#安装)\n    - [Linux](#linux)\n  - [Intro](#intro-1)\n- [Intro](#intro-2)\n"
+		if !strings.HasPrefix(got, toc) {
+			t.Errorf("%s: got %q", flavor, got)
+		}
+		heading := "## 安装 {#安装}\n"
+		if flavor == FlavorCommonMark {
+			heading = "## <a id=\"安装\"></a>安装\n"
+		}
+		if !strings.Contains(got, heading) {
+			t.Errorf("%s: no anchor in %q", flavor, got)
+		}
+
+		tree, _ := json.Marshal(tm.headingTree())
+		want := `[{"level":1,"title":"Intro","id":"intro","children":[{"level":2,"title":"安装","id":"安装","children":[{"level":3,"title":"Linux","id":"linux"}]},{"level":2,"title":"Intro","id":"intro-1"}]},{"level":1,"title":"Intro","id":"intro-2"}]`
+		if string(tree) != want {
+			t.Errorf("got %s", tree)
+		}
+	}
+}
+
+func TestMarkdownHeadings(t *testing.T) {
+	md := "## Einführung [^comment-1] {#intro}\n\n```sh\n# not a heading\n```\n\n### <a id=\"setup\"></a>Installation\n"
+	tree, _ := json.Marshal(markdownHeadings(md))
+	want := `[{"level":2,"title":"Einführung","id":"intro","children":[{"level":3,"title":"Installation","id":"setup"}]}]`
+	if string(tree) != want {
+		t.Errorf("got %s", tree)
+	}
+}
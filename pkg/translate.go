@@ -0,0 +1,300 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Translator translates markdown from the source to the target language
+type Translator interface {
+	Translate(text, source, target string) (string, error)
+}
+
+// HTTPTranslator posts {"text", "source", "target", "format": "markdown"} as
+// json to Endpoint and reads the translation from the "text" of the answer
+type HTTPTranslator struct {
+	Endpoint string
+	APIKey   string
+	client   *http.Client
+}
+
+// default front matter values translated with the page
+var defaultTranslationKeys = []string{"title", "description", "summary"}
+
+// NewTranslator the translator of config, nil without an endpoint
+func NewTranslator(config Translation) Translator {
+	if config.Endpoint == "" {
+		return nil
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 120
+	}
+	apiKey := config.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("TRANSLATION_API_KEY")
+	}
+	return &HTTPTranslator{
+		Endpoint: config.Endpoint,
+		APIKey:   apiKey,
+		client:   &http.Client{Timeout: time.Duration(timeout) * time.Second},
+	}
+}
+
+func (t *HTTPTranslator) Translate(text, source, target string) (string, error) {
+	body, err := json.Marshal(map[string]string{"text": text, "source": source, "target": target, "format": "markdown"})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.APIKey)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("translate: %s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("translate: %w", err)
+	}
+	return result.Text, nil
+}
+
+// what translators must leave alone: code, shortcodes, html, link targets,
+// footnote refs, heading anchors, urls and tokens
+var protectedMarkdown = regexp.MustCompile("(?s)```.*?```|`[^`\n]+`|\\{\\{[<%].*?[%>]\\}\\}|<!--.*?-->|<[^>\n]+>|" +
+	`\]\([^)\s]*\)|\[\^[^\]]+\]|\{#[^}]*\}|https?://[^\s)]+|@@[\w-]+(:\d+)?@@`)
+
+var protectedToken = regexp.MustCompile(`@@(\d+)@@`)
+
+// protectMarkdown replaces the protected parts of md with @@N@@ tokens
+func protectMarkdown(md string) (string, []string) {
+	var kept []string
+	masked := protectedMarkdown.ReplaceAllStringFunc(md, func(s string) string {
+		kept = append(kept, s)
+		return fmt.Sprintf("@@%d@@", len(kept)-1)
+	})
+	return masked, kept
+}
+
+// restoreMarkdown puts the protected parts back, all tokens must have survived
+func restoreMarkdown(text string, kept []string) (string, error) {
+	for i := range kept {
+		if token := fmt.Sprintf("@@%d@@", i); !strings.Contains(text, token) {
+			return "", fmt.Errorf("the translation lost %s (%.40q)", token, kept[i])
+		}
+	}
+	return protectedToken.ReplaceAllStringFunc(text, func(token string) string {
+		i, _ := strconv.Atoi(protectedToken.FindStringSubmatch(token)[1])
+		if i < len(kept) {
+			return kept[i]
+		}
+		return token
+	}), nil
+}
+
+func translateMarkdown(t Translator, md, source, target string) (string, error) {
+	masked, kept := protectMarkdown(md)
+	if strings.TrimSpace(protectedToken.ReplaceAllString(masked, "")) == "" {
+		return md, nil
+	}
+	translated, err := t.Translate(masked, source, target)
+	if err != nil {
+		return "", err
+	}
+	return restoreMarkdown(translated, kept)
+}
+
+// translationBundle the languages a page was rendered in
+type translationBundle struct {
+	dir string
+	// name of the markdown file without language, index.md
+	name  string
+	pages map[string]renderedPage
+	langs []string
+}
+
+type renderedPage struct {
+	fm      *FrontMatter
+	content []byte
+}
+
+// recordTranslation remembers the rendered page for translateMissing
+func (ns *NotionSite) recordTranslation(fm *FrontMatter, content []byte) {
+	lang := ns.currentPageProp.Language
+	name := strings.Replace(filepath.Base(ns.files.FilePath), "."+lang+".", ".", 1)
+	key := filepath.Join(ns.files.FileFolderPath, name)
+	if ns.bundles == nil {
+		ns.bundles = make(map[string]*translationBundle)
+	}
+	b, ok := ns.bundles[key]
+	if !ok {
+		b = &translationBundle{dir: ns.files.FileFolderPath, name: name, pages: make(map[string]renderedPage)}
+		ns.bundles[key] = b
+		ns.bundleKeys = append(ns.bundleKeys, key)
+	}
+	if _, ok := b.pages[lang]; !ok {
+		b.langs = append(b.langs, lang)
+	}
+	b.pages[lang] = renderedPage{fm: fm, content: content}
+}
+
+// translateMissing machine translates the pages missing a translation
+// language, from their default language version else the first rendered one
+func (ns *NotionSite) translateMissing() []*FrontMatter {
+	var fms []*FrontMatter
+	config := ns.config.Translation
+	if ns.translator == nil || len(config.Languages) == 0 {
+		return nil
+	}
+	for _, key := range ns.bundleKeys {
+		b := ns.bundles[key]
+		source := b.langs[0]
+		if _, ok := b.pages[strings.ToLower(ns.config.DefaultLanguage)]; ok {
+			source = strings.ToLower(ns.config.DefaultLanguage)
+		}
+		for _, target := range config.Languages {
+			target = strings.ToLower(target)
+			if _, ok := b.pages[target]; ok {
+				continue
+			}
+			path := filepath.Join(b.dir, languageFileName(b.name, target))
+			if ns.plan != nil {
+				ns.planTranslation(b.pages[source], path, source)
+				continue
+			}
+			fmt.Printf("🌐 Translating %s from %s\n", path, source)
+			fm, err := ns.translatePage(b.pages[source], path, source, target)
+			if err != nil {
+				fmt.Printf("❌ Translating %s: %s\n", path, err)
+				continue
+			}
+			fms = append(fms, fm)
+		}
+	}
+	return fms
+}
+
+// planTranslation records in the dry run plan what translatePage would write,
+// without calling the translator
+func (ns *NotionSite) planTranslation(page renderedPage, path, source string) {
+	if old, err := os.ReadFile(path); err == nil {
+		if oldMeta, _ := splitFrontMatter(old); oldMeta["translationSource"] == translationHash(page) {
+			ns.plan.AddFile(path, old)
+			return
+		}
+	}
+	ns.plan.AddTranslation(path, source)
+}
+
+// translationHash identifies the source content of a translation
+func translationHash(page renderedPage) string {
+	sum := sha256.Sum256(page.content)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// translatePage writes the target translation of page to path. A translation
+// of the same source content is kept as is.
+func (ns *NotionSite) translatePage(page renderedPage, path, source, target string) (*FrontMatter, error) {
+	hash := translationHash(page)
+	meta, body := splitFrontMatter(page.content)
+	if old, err := os.ReadFile(path); err == nil {
+		if oldMeta, oldBody := splitFrontMatter(old); oldMeta["translationSource"] == hash {
+			return translatedFrontMatter(page.fm, oldMeta, oldBody, target)
+		}
+	}
+
+	translated, err := translateMarkdown(ns.translator, body, source, target)
+	if err != nil {
+		return nil, err
+	}
+	keys := ns.config.Translation.Keys
+	if len(keys) == 0 {
+		keys = defaultTranslationKeys
+	}
+	for _, key := range keys {
+		for k, v := range meta {
+			if s, ok := v.(string); ok && s != "" && strings.EqualFold(k, key) {
+				if meta[k], err = translateMarkdown(ns.translator, s, source, target); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	stats := pageStats(translated)
+	meta["wordCount"], meta["readingTime"], meta["isCJKLanguage"] = stats.WordCount, stats.ReadingTime, stats.IsCJKLanguage
+	meta["machineTranslated"] = true
+	meta["translationSource"] = hash
+
+	out, err := yaml.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	content := append(append([]byte("---\n"), out...), []byte("---\n"+translated)...)
+	if err := ns.writeFile(path, content); err != nil {
+		return nil, err
+	}
+	return translatedFrontMatter(page.fm, meta, translated, target)
+}
+
+// translatedFrontMatter the blogs.json entry of a translation: its headings
+// come from the translated body, its path is the one of the shared bundle
+func translatedFrontMatter(source *FrontMatter, meta map[string]any, body, target string) (*FrontMatter, error) {
+	path, err := accessPath(source)
+	if err != nil {
+		return nil, err
+	}
+	fm := *source
+	fm.AccessPath = path
+	fm.Headings = markdownHeadings(body)
+	fm.Language = target
+	fm.MachineTranslated = true
+	fm.Title, _ = meta["title"].(string)
+	fm.Description, _ = meta["description"].(string)
+	fm.Summary, _ = meta["summary"].(string)
+	fm.WordCount, _ = meta["wordCount"].(int)
+	fm.ReadingTime, _ = meta["readingTime"].(int)
+	return &fm, nil
+}
+
+// splitFrontMatter the yaml front matter and the body of a markdown file
+func splitFrontMatter(content []byte) (map[string]any, string) {
+	meta := make(map[string]any)
+	s := string(content)
+	if !strings.HasPrefix(s, "---\n") {
+		return meta, s
+	}
+	end := strings.Index(s[4:], "\n---\n")
+	if end < 0 {
+		return meta, s
+	}
+	if err := yaml.Unmarshal([]byte(s[4:4+end]), &meta); err != nil {
+		return make(map[string]any), s
+	}
+	return meta, s[4+end+5:]
+}
@@ -0,0 +1,135 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProtectMarkdown(t *testing.T) {
+	md := "## 安装 {#安装}\n\n运行 `go install` 或看 [文档](https://example.com/docs)[^comment-1]。\n\n" +
+		"```go\nfmt.Println(\"你好\")\n```\n\n{{< figure src=\"a.png\" >}}\n<!--more-->\n"
+	masked, kept := protectMarkdown(md)
+	for _, s := range []string{"go install", "example.com", "你好", "figure", "more", "{#"} {
+		if strings.Contains(masked, s) {
+			t.Errorf("%q not protected: %s", s, masked)
+		}
+	}
+	got, err := restoreMarkdown(masked, kept)
+	if err != nil || got != md {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err := restoreMarkdown(strings.Replace(masked, "@@1@@", "", 1), kept); err == nil {
+		t.Error("lost token not reported")
+	}
+}
+
+// stubTranslator upper cases the text, as the target language
+func stubTranslator(t *testing.T, calls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req["source"] != "en" || req["target"] != "de" || r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		*calls++
+		json.NewEncoder(w).Encode(map[string]string{"text": strings.ToUpper(req["text"])})
+	}))
+}
+
+func TestTranslateMissing(t *testing.T) {
+	var calls int
+	server := stubTranslator(t, &calls)
+	defer server.Close()
+
+	dir := t.TempDir()
+	config := Config{Notion: Notion{DefaultLanguage: "en"}, Markdown: Markdown{
+		Translation: Translation{Languages: []string{"en", "zh", "DE"}, Endpoint: server.URL, APIKey: "key"},
+	}}
+	ns := &NotionSite{config: config}
+	ns.SetTranslator(NewTranslator(config.Translation))
+	content := "---\ntitle: hello world\ntranslationKey: hello\n---\n## Intro {#intro}\n\nsee `code` and [docs](https://example.com)\n"
+	source := &FrontMatter{Title: "hello world", Language: "en", Headings: []*Heading{{Level: 2, Title: "Intro", ID: "intro"}}}
+	ns.files = &Files{FileFolderPath: dir, FilePath: filepath.Join(dir, "index.en.md")}
+	ns.currentPageProp = &NotionProp{Language: "en"}
+	ns.recordTranslation(source, []byte(content))
+	ns.files.FilePath = filepath.Join(dir, "index.zh.md")
+	ns.currentPageProp = &NotionProp{Language: "zh"}
+	ns.recordTranslation(&FrontMatter{Language: "zh"}, []byte("---\ntitle: 你好\n---\n你好\n"))
+
+	fms := ns.translateMissing()
+	if len(fms) != 1 || fms[0].Language != "de" || fms[0].Title != "HELLO WORLD" || !fms[0].MachineTranslated {
+		t.Fatalf("got %+v", fms)
+	}
+	out, err := os.ReadFile(filepath.Join(dir, "index.de.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, body := splitFrontMatter(out)
+	if body != "## INTRO {#intro}\n\nSEE `code` AND [DOCS](https://example.com)\n" {
+		t.Errorf("got body %q", body)
+	}
+	if meta["machineTranslated"] != true || meta["translationKey"] != "hello" || meta["title"] != "HELLO WORLD" {
+		t.Errorf("got front matter %v", meta)
+	}
+	// the blogs.json entry of the translation
+	if fms[0].AccessPath != "hello-world" || len(fms[0].Headings) != 1 || fms[0].Headings[0].Title != "INTRO" || fms[0].Headings[0].ID != "intro" {
+		t.Errorf("got %+v", fms[0])
+	}
+
+	// an unchanged source keeps its translation
+	calls = 0
+	if fms := ns.translateMissing(); len(fms) != 1 || calls != 0 {
+		t.Errorf("translated again: %d calls", calls)
+	}
+}
+
+func TestTranslateMissingDryRun(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{Notion: Notion{DefaultLanguage: "en"}, Markdown: Markdown{
+		Translation: Translation{Languages: []string{"en", "de", "zh"}},
+	}}
+	ns := &NotionSite{config: config, plan: NewPlan()}
+	var calls int
+	ns.SetTranslator(translatorFunc(func(text, source, target string) (string, error) {
+		calls++
+		return text, nil
+	}))
+	content := []byte("---\ntitle: hello\n---\nhello\n")
+	ns.files = &Files{FileFolderPath: dir, FilePath: filepath.Join(dir, "index.en.md")}
+	ns.currentPageProp = &NotionProp{Language: "en"}
+	ns.recordTranslation(&FrontMatter{Title: "hello", Language: "en"}, content)
+	// an up to date translation
+	zh := []byte("---\ntranslationSource: " + translationHash(renderedPage{content: content}) + "\n---\n你好\n")
+	os.WriteFile(filepath.Join(dir, "index.zh.md"), zh, 0644)
+
+	if fms := ns.translateMissing(); len(fms) != 0 || calls != 0 {
+		t.Errorf("dry run translated %d pages, %d calls", len(fms), calls)
+	}
+	want := map[string]string{"index.de.md": planCreate, "index.zh.md": planKeep}
+	for _, f := range ns.plan.Files {
+		if want[filepath.Base(f.Path)] != f.Action {
+			t.Errorf("%s: got %s", f.Path, f.Action)
+		}
+		delete(want, filepath.Base(f.Path))
+	}
+	if len(want) > 0 {
+		t.Errorf("not planned: %v", want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "index.de.md")); !os.IsNotExist(err) {
+		t.Error("dry run wrote the translation")
+	}
+}
+
+type translatorFunc func(text, source, target string) (string, error)
+
+func (f translatorFunc) Translate(text, source, target string) (string, error) {
+	return f(text, source, target)
+}